@@ -5,18 +5,83 @@ export type AliasResponse = {
 
 export type AliasListResponse = {
 	aliases: AliasResponse[];
+	total: number;
+	limit?: number;
+	offset?: number;
+};
+
+export type DomainListResponse = {
+	domains: string[];
 };
 
 export type EmailsListResponse = {
 	emails: string[];
+	total: number;
+	limit?: number;
+	offset?: number;
+};
+
+export type AliasPathResponse = {
+	alias: string;
+	path: string[];
+};
+
+export type MailboxAliasesResponse = {
+	email: string;
+	aliases: AliasPathResponse[];
 };
 
 export type ErrorResponse = {
 	error: string;
+	code?: string;
 };
 
 export type StatusResponse = {
 	running: boolean;
+	health?: string;
+	name?: string;
+	id?: string;
+	image?: string;
+	tag?: string;
+	started_at?: string;
+	uptime_seconds?: number;
+	restart_count?: number;
+	version?: string;
+	account_provisioner?: string;
+	mailboxes?: number;
+	aliases?: number;
+	dangling_aliases?: number;
+};
+
+export type EventResponse = {
+	type:
+		| "alias_created"
+		| "alias_deleted"
+		| "aliases_changed"
+		| "mailboxes_changed"
+		| "status_changed";
+	alias?: AliasResponse;
+	status?: StatusResponse;
+};
+
+export type ApiTokenScope = "read" | "aliases-write";
+
+export type ApiTokenResponse = {
+	id: string;
+	name: string;
+	scopes: ApiTokenScope[];
+	domains: string[];
+	created_at: string;
+	created_by?: string;
+	last_used_at?: string;
+};
+
+export type ApiTokenCreatedResponse = ApiTokenResponse & {
+	token: string;
+};
+
+export type ApiTokenListResponse = {
+	tokens: ApiTokenResponse[];
 };
 
 export type Toast = {
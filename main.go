@@ -1,12 +1,23 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/scheidti/docker-mailserver-aliases/docs"
+	"github.com/scheidti/docker-mailserver-aliases/models"
 	"github.com/scheidti/docker-mailserver-aliases/routes"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -29,29 +40,240 @@ import (
 var frontend embed.FS
 
 func main() {
-	engine := gin.Default()
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		os.Exit(healthcheck(os.Args[2:]))
+	}
+
+	args := os.Args[1:]
+	config, err := models.LoadConfig(args, os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%s\n", err)
+		os.Exit(2)
+	}
+	models.SetConfig(config)
+	routes.ApplyConfig()
+
+	var logLevel slog.LevelVar
+	logLevel.Set(config.LogLevel)
+	slog.SetDefault(routes.NewLogger(os.Stdout, &logLevel, config.LogFormat))
+	slog.Info("Configuration loaded", slog.Any("config", config))
+	go reloadConfigOnSIGHUP(args, &logLevel)
+
+	if err := routes.LoadAPITokens(config.APITokenFile); err != nil {
+		slog.Error("Failed to load API tokens", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := routes.SetupTracing(context.Background())
+	if err != nil {
+		slog.Error("Failed to set up tracing", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
+	docker, err := routes.NewDockerClient(context.Background())
+	if err != nil {
+		slog.Error("Failed to create Docker client", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	defer docker.Close()
+	handler := routes.NewHandler(docker)
+
+	engine := gin.New()
+	if err := engine.SetTrustedProxies(config.TrustedProxies); err != nil {
+		slog.Error("Invalid trusted proxies", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	engine.Use(
+		routes.TracingMiddleware(),
+		routes.RequestIDMiddleware,
+		routes.LoggingMiddleware,
+		routes.MetricsMiddleware,
+		routes.RecoveryMiddleware,
+		routes.SecurityHeadersMiddleware,
+		routes.CORSMiddleware,
+		routes.BodyLimitMiddleware,
+	)
 	docs.SwaggerInfo.BasePath = "/"
 
-	api := engine.Group("/v1")
+	api := engine.Group("/v1",
+		routes.CrossOriginProtectionMiddleware,
+		routes.RateLimitMiddleware,
+		routes.APITokenMiddleware,
+		routes.ForwardAuthMiddleware,
+		routes.UserRateLimitMiddleware,
+		routes.IdempotencyMiddleware,
+	)
+	read := routes.RequireScope(routes.ScopeRead)
+	writeAliases := routes.RequireScope(routes.ScopeAliasesWrite)
 	{
-		api.GET("/status", routes.StatusGetHandler)
-		api.GET("/emails", routes.EmailsGetHandler)
-		api.GET("/aliases", routes.AliasesGetHandler)
-		api.POST("/aliases", routes.AliasesPostHandler)
-		api.DELETE("/aliases/:alias", routes.AliasesDeleteHandler)
+		api.GET("/status", read, handler.StatusGetHandler)
+		api.GET("/domains", read, handler.DomainsGetHandler)
+		api.GET("/emails", read, handler.EmailsGetHandler)
+		api.GET("/emails/:email/aliases", read, handler.EmailAliasesGetHandler)
+		api.GET("/aliases", read, handler.AliasesGetHandler)
+		api.GET("/aliases/cycles", read, handler.AliasCyclesGetHandler)
+		api.GET("/aliases/dangling", read, handler.DanglingAliasesGetHandler)
+		api.POST("/aliases/dangling", writeAliases, handler.DanglingAliasesPostHandler)
+		api.POST("/aliases", writeAliases, handler.AliasesPostHandler)
+		api.DELETE("/aliases/:alias", writeAliases, handler.AliasesDeleteHandler)
+		api.GET("/events", read, routes.EventsGetHandler)
 	}
 
-	addr := os.Getenv("GIN_ADDR")
-	if addr == "" {
-		addr = ":8080"
+	tokens := api.Group("/tokens", routes.APITokenManagementMiddleware)
+	{
+		tokens.GET("", routes.APITokensGetHandler)
+		tokens.POST("", routes.APITokensPostHandler)
+		tokens.DELETE("/:id", routes.APITokensDeleteHandler)
 	}
 
+	engine.GET("/metrics", routes.MetricsHandler)
+	engine.GET("/healthz", routes.HealthzGetHandler)
+	engine.GET("/readyz", handler.ReadyzGetHandler)
+
 	if gin.Mode() != gin.ReleaseMode {
-		engine.GET("/docs/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+		engine.GET("/docs/*any", routes.DocsSecurityHeadersMiddleware, ginSwagger.WrapHandler(swaggerFiles.Handler))
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	go handler.WatchDockerEvents(ctx)
+	go handler.CheckDanglingAliases(ctx)
+
 	engine.NoRoute(serveFrontend)
-	engine.Run(addr)
+	if err := serve(ctx, config, engine); err != nil {
+		slog.Error("Server failed", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	slog.Info("Server stopped")
+}
+
+// serve serves the handler via HTTPS if a certificate is configured, and via
+// plain HTTP otherwise, until the context is cancelled. The servers then stop
+// accepting connections and wait up to SHUTDOWN_TIMEOUT for the requests in
+// progress, so that changes to the mailserver are not interrupted.
+func serve(ctx context.Context, config models.Config, handler http.Handler) error {
+	server := &http.Server{
+		Addr:              config.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+	server.RegisterOnShutdown(routes.CloseEventStreams)
+	servers := []*http.Server{server}
+	errs := make(chan error, 2)
+
+	if config.TLSEnabled() {
+		tlsConfig, err := routes.NewTLSConfig(config.TLSCertPath, config.TLSKeyPath, config.TLSMinVersion)
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = tlsConfig
+
+		slog.Info("Serving HTTPS", slog.String("addr", config.Addr), slog.String("min_tls_version", config.TLSMinVersion))
+		go func() { errs <- server.ListenAndServeTLS("", "") }()
+	} else {
+		slog.Info("Serving HTTP", slog.String("addr", config.Addr))
+		go func() { errs <- server.ListenAndServe() }()
+	}
+
+	if config.HTTPRedirectAddr != "" {
+		redirect := &http.Server{
+			Addr:              config.HTTPRedirectAddr,
+			Handler:           routes.RedirectToHTTPS(config.Addr),
+			ReadHeaderTimeout: config.ReadHeaderTimeout,
+			ReadTimeout:       config.ReadTimeout,
+			WriteTimeout:      config.WriteTimeout,
+			IdleTimeout:       config.IdleTimeout,
+		}
+		servers = append(servers, redirect)
+
+		slog.Info("Redirecting HTTP to HTTPS", slog.String("addr", config.HTTPRedirectAddr))
+		go func() { errs <- redirect.ListenAndServe() }()
+	}
+
+	var serveErr error
+	select {
+	case serveErr = <-errs:
+	case <-ctx.Done():
+		slog.Info("Shutting down, waiting for requests in progress", slog.Duration("timeout", config.ShutdownTimeout))
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	for _, s := range servers {
+		if err := s.Shutdown(shutdownCtx); err != nil {
+			s.Close()
+			return fmt.Errorf("requests still in progress after %s were aborted: %w", config.ShutdownTimeout, err)
+		}
+	}
+	return serveErr
+}
+
+// reloadConfigOnSIGHUP loads the configuration again whenever the process
+// receives SIGHUP. An invalid configuration is logged and ignored.
+func reloadConfigOnSIGHUP(args []string, logLevel *slog.LevelVar) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		restart, err := models.ReloadConfig(args, os.LookupEnv)
+		if err != nil {
+			slog.Error("Failed to reload configuration, keeping the current one", slog.String("error", err.Error()))
+			continue
+		}
+		if len(restart) > 0 {
+			slog.Warn("Changed settings require a restart", slog.String("settings", strings.Join(restart, ", ")))
+		}
+
+		logLevel.Set(models.GetLogLevel())
+		routes.ApplyConfig()
+		slog.Info("Configuration reloaded", slog.Any("config", models.GetConfig()))
+	}
+}
+
+// healthcheck queries the liveness probe of a running instance, so that it
+// can be used as Docker HEALTHCHECK in images without any other tools. It
+// takes the same configuration as the server to find its address.
+func healthcheck(args []string) int {
+	config, err := models.LoadConfig(args, os.LookupEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	addr := config.Addr
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+
+	scheme := "http"
+	client := http.Client{Timeout: 3 * time.Second}
+	if config.TLSEnabled() {
+		// The certificate is issued for the public name of the server, not
+		// for localhost
+		scheme = "https"
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	resp, err := client.Get(scheme + "://" + addr + "/healthz")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "unexpected status %s\n", resp.Status)
+		return 1
+	}
+	return 0
 }
 
 func serveFrontend(c *gin.Context) {
@@ -0,0 +1,521 @@
+package models
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of the application. Every setting can be set in
+// the config file under the key of its config tag, as environment variable
+// named by its env tag or, with the secret in a file, by the env name with a
+// _FILE suffix, and as command-line flag named like the key with dashes.
+// Flags take precedence over environment variables, which take precedence
+// over the config file.
+//
+// Settings tagged with reload are applied on SIGHUP, the others need a
+// restart. Values of settings tagged with secret are redacted when logged.
+type Config struct {
+	Addr                  string        `config:"addr" env:"GIN_ADDR" usage:"Address the HTTP server listens on"`
+	DockerImage           string        `config:"docker_mailserver_image" env:"DOCKER_MAILSERVER_IMAGE" reload:"true" usage:"Image of the Docker Mailserver container"`
+	CacheTTL              time.Duration `config:"cache_ttl" env:"CACHE_TTL" check:"nonnegative" reload:"true" usage:"How long alias and email lists are cached, 0 disables caching"`
+	ReadinessTimeout      time.Duration `config:"readiness_timeout" env:"READINESS_TIMEOUT" check:"positive" reload:"true" usage:"Deadline of the readiness checks"`
+	AliasMaxDepth         int           `config:"alias_max_depth" env:"ALIAS_MAX_DEPTH" check:"positive" reload:"true" usage:"Maximum length of alias chains"`
+	DockerTimeout         time.Duration `config:"docker_timeout" env:"DOCKER_TIMEOUT" check:"positive" reload:"true" usage:"Deadline of Docker API calls"`
+	ListTimeout           time.Duration `config:"list_timeout" env:"LIST_TIMEOUT" check:"positive" reload:"true" usage:"Deadline of listing aliases and mailboxes"`
+	ChangeTimeout         time.Duration `config:"change_timeout" env:"CHANGE_TIMEOUT" check:"positive" reload:"true" usage:"Deadline of changes to the mailserver"`
+	DanglingCheckInterval time.Duration `config:"dangling_check_interval" env:"DANGLING_CHECK_INTERVAL" check:"nonnegative" usage:"Interval of counting dangling aliases, 0 disables the check"`
+	MailDomains           []string      `config:"mail_domains" env:"MAIL_DOMAINS" reload:"true" usage:"Comma-separated domains hosted in addition to the domains of the mailboxes"`
+	LockFile              string        `config:"lock_file" env:"LOCK_FILE" usage:"File locked during changes to serialize them across processes"`
+	LockTimeout           time.Duration `config:"lock_timeout" env:"LOCK_TIMEOUT" check:"positive" reload:"true" usage:"How long a change waits for other changes to finish"`
+	IdempotencyTTL        time.Duration `config:"idempotency_ttl" env:"IDEMPOTENCY_TTL" check:"positive" reload:"true" usage:"How long responses to requests with an Idempotency-Key are kept"`
+	LogLevel              slog.Level    `config:"log_level" env:"LOG_LEVEL" reload:"true" usage:"Log level: debug, info, warn or error"`
+	LogFormat             string        `config:"log_format" env:"LOG_FORMAT" check:"text|json" usage:"Log format: text or json"`
+	TLSCertPath           string        `config:"tls_cert_path" env:"TLS_CERT_PATH" usage:"Certificate file to serve HTTPS, reloaded when it changes"`
+	TLSKeyPath            string        `config:"tls_key_path" env:"TLS_KEY_PATH" usage:"Private key file to serve HTTPS, reloaded when it changes"`
+	TLSMinVersion         string        `config:"tls_min_version" env:"TLS_MIN_VERSION" check:"1.2|1.3" usage:"Minimum TLS version: 1.2 or 1.3"`
+	HTTPRedirectAddr      string        `config:"http_redirect_addr" env:"HTTP_REDIRECT_ADDR" usage:"Address of a plain HTTP listener redirecting to HTTPS"`
+	ReadHeaderTimeout     time.Duration `config:"read_header_timeout" env:"READ_HEADER_TIMEOUT" check:"positive" usage:"Deadline for reading the request headers"`
+	ReadTimeout           time.Duration `config:"read_timeout" env:"READ_TIMEOUT" check:"positive" usage:"Deadline for reading the whole request"`
+	WriteTimeout          time.Duration `config:"write_timeout" env:"WRITE_TIMEOUT" check:"nonnegative" usage:"Deadline for handling a request and writing the response, 0 disables it"`
+	IdleTimeout           time.Duration `config:"idle_timeout" env:"IDLE_TIMEOUT" check:"positive" usage:"How long idle keep-alive connections are kept open"`
+	ShutdownTimeout       time.Duration `config:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" check:"positive" usage:"How long the shutdown waits for requests in progress"`
+	MaxBodySize           int           `config:"max_body_size" env:"MAX_BODY_SIZE" check:"positive" reload:"true" usage:"Maximum size of request bodies in bytes"`
+	RateLimit             Rate          `config:"rate_limit" env:"RATE_LIMIT" reload:"true" usage:"Requests per client IP and per credential, like 10/s, or off"`
+	MutationRateLimit     Rate          `config:"mutation_rate_limit" env:"MUTATION_RATE_LIMIT" reload:"true" usage:"Changes per client IP and per credential, like 30/m, or off"`
+	AuthFailureRateLimit  Rate          `config:"auth_failure_rate_limit" env:"AUTH_FAILURE_RATE_LIMIT" reload:"true" usage:"Rejected credentials per client IP, like 5/m, or off"`
+	TrustedProxies        []string      `config:"trusted_proxies" env:"TRUSTED_PROXIES" usage:"Comma-separated IPs or CIDRs of reverse proxies whose X-Forwarded-For header is trusted"`
+	CORSAllowedOrigins    []string      `config:"cors_allowed_origins" env:"CORS_ALLOWED_ORIGINS" reload:"true" usage:"Comma-separated origins, like https://tools.example.com, allowed to call the API from the browser"`
+	ForwardAuthProxies    []string      `config:"forward_auth_proxies" env:"FORWARD_AUTH_PROXIES" reload:"true" usage:"Comma-separated IPs or CIDRs of authenticating reverse proxies, enables forward authentication"`
+	ForwardAuthUser       string        `config:"forward_auth_user_header" env:"FORWARD_AUTH_USER_HEADER" reload:"true" usage:"Header with the user authenticated by the reverse proxy"`
+	ForwardAuthGroups     string        `config:"forward_auth_groups_header" env:"FORWARD_AUTH_GROUPS_HEADER" reload:"true" usage:"Header with the comma-separated groups of the user"`
+	APITokenFile          string        `config:"api_token_file" env:"API_TOKEN_FILE" usage:"File storing the hashed API tokens, enables API tokens"`
+	OTLPEndpoint          string        `config:"otel_exporter_otlp_endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" usage:"Base URL of the OTLP/HTTP collector, enables tracing"`
+	OTLPTracesEndpoint    string        `config:"otel_exporter_otlp_traces_endpoint" env:"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT" usage:"URL traces are sent to, overrides the base URL, enables tracing"`
+	OTLPHeaders           string        `config:"otel_exporter_otlp_headers" env:"OTEL_EXPORTER_OTLP_HEADERS" secret:"true" usage:"Comma-separated key=value headers sent to the OTLP collector, like API keys"`
+}
+
+// DefaultConfig returns the configuration used for settings that are not set.
+func DefaultConfig() Config {
+	return Config{
+		Addr:                  ":8080",
+		DockerImage:           "mailserver/docker-mailserver",
+		CacheTTL:              30 * time.Second,
+		ReadinessTimeout:      5 * time.Second,
+		AliasMaxDepth:         10,
+		DockerTimeout:         5 * time.Second,
+		ListTimeout:           30 * time.Second,
+		ChangeTimeout:         time.Minute,
+		DanglingCheckInterval: time.Hour,
+		MailDomains:           []string{},
+		LockTimeout:           10 * time.Second,
+		IdempotencyTTL:        24 * time.Hour,
+		LogLevel:              slog.LevelInfo,
+		LogFormat:             "text",
+		TLSMinVersion:         "1.2",
+		ReadHeaderTimeout:     10 * time.Second,
+		ReadTimeout:           30 * time.Second,
+		WriteTimeout:          2 * time.Minute,
+		IdleTimeout:           2 * time.Minute,
+		ShutdownTimeout:       90 * time.Second,
+		MaxBodySize:           1 << 20,
+		RateLimit:             Rate{Count: 10, Per: time.Second},
+		MutationRateLimit:     Rate{Count: 30, Per: time.Minute},
+		AuthFailureRateLimit:  Rate{Count: 5, Per: time.Minute},
+		TrustedProxies:        []string{},
+		CORSAllowedOrigins:    []string{},
+		ForwardAuthProxies:    []string{},
+		ForwardAuthUser:       "Remote-User",
+		ForwardAuthGroups:     "Remote-Groups",
+	}
+}
+
+// TLSEnabled reports whether the server is configured to serve HTTPS.
+func (c Config) TLSEnabled() bool {
+	return c.TLSCertPath != "" && c.TLSKeyPath != ""
+}
+
+// validate checks settings that depend on each other.
+func (c Config) validate() error {
+	var errs []error
+	if (c.TLSCertPath == "") != (c.TLSKeyPath == "") {
+		errs = append(errs, errors.New("TLS_CERT_PATH and TLS_KEY_PATH must be set together"))
+	}
+	if c.HTTPRedirectAddr != "" && !c.TLSEnabled() {
+		errs = append(errs, errors.New("HTTP_REDIRECT_ADDR requires TLS_CERT_PATH and TLS_KEY_PATH"))
+	}
+	for _, proxy := range c.TrustedProxies {
+		if !isIPOrPrefix(proxy) {
+			errs = append(errs, fmt.Errorf("invalid TRUSTED_PROXIES %q: expected an IP address or CIDR", proxy))
+		}
+	}
+	for _, proxy := range c.ForwardAuthProxies {
+		if !isIPOrPrefix(proxy) {
+			errs = append(errs, fmt.Errorf("invalid FORWARD_AUTH_PROXIES %q: expected an IP address or CIDR", proxy))
+		}
+	}
+	for _, origin := range c.CORSAllowedOrigins {
+		if !isOrigin(origin) {
+			errs = append(errs, fmt.Errorf("invalid CORS_ALLOWED_ORIGINS %q: expected an origin like https://tools.example.com", origin))
+		}
+	}
+	if c.APITokenFile != "" && len(c.ForwardAuthProxies) == 0 {
+		errs = append(errs, errors.New("API_TOKEN_FILE requires FORWARD_AUTH_PROXIES, otherwise requests without a token would not be limited"))
+	}
+	if c.WriteTimeout > 0 && c.WriteTimeout <= c.ChangeTimeout+c.LockTimeout {
+		errs = append(errs, errors.New("WRITE_TIMEOUT must be longer than CHANGE_TIMEOUT plus LOCK_TIMEOUT, or 0"))
+	}
+	if c.ShutdownTimeout <= c.ChangeTimeout+c.LockTimeout {
+		errs = append(errs, errors.New("SHUTDOWN_TIMEOUT must be longer than CHANGE_TIMEOUT plus LOCK_TIMEOUT"))
+	}
+	if c.OTLPEndpoint != "" && !isHTTPURL(c.OTLPEndpoint) {
+		errs = append(errs, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_ENDPOINT %q: expected an HTTP or HTTPS URL", c.OTLPEndpoint))
+	}
+	if c.OTLPTracesEndpoint != "" && !isHTTPURL(c.OTLPTracesEndpoint) {
+		errs = append(errs, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_TRACES_ENDPOINT %q: expected an HTTP or HTTPS URL", c.OTLPTracesEndpoint))
+	}
+	// The value is not reported, as it usually contains credentials
+	if _, err := parseOTLPHeaders(c.OTLPHeaders); err != nil {
+		errs = append(errs, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+func isIPOrPrefix(value string) bool {
+	if _, err := netip.ParsePrefix(value); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(value)
+	return err == nil
+}
+
+// isOrigin reports whether the value is a web origin, i.e. an HTTP or HTTPS
+// URL without path, query or credentials.
+func isOrigin(value string) bool {
+	u, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.User == nil &&
+		u.Path == "" && u.RawQuery == "" && u.Fragment == "" && !u.ForceQuery
+}
+
+func isHTTPURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// parseOTLPHeaders parses headers in the format of OTEL_EXPORTER_OTLP_HEADERS,
+// comma-separated key=value pairs with percent-encoded values.
+func parseOTLPHeaders(value string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, errors.New("expected comma-separated key=value pairs")
+		}
+		value, err := url.PathUnescape(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid percent-encoding in the value of %s", key)
+		}
+		headers[key] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// OTLPTracesURL returns the URL traces are exported to, or an empty string if
+// tracing is disabled. Like the OpenTelemetry SDK, /v1/traces is appended to
+// the base URL.
+func (c Config) OTLPTracesURL() string {
+	if c.OTLPTracesEndpoint != "" {
+		return c.OTLPTracesEndpoint
+	}
+	if c.OTLPEndpoint != "" {
+		return strings.TrimSuffix(c.OTLPEndpoint, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+const configFileFlag = "config"
+
+// configFileEnv is the environment variable with the path of the config
+// file, which can also be given with the -config flag.
+const configFileEnv = "CONFIG_FILE"
+
+// LoadConfig reads the configuration from the config file, the environment
+// and the command-line arguments. All invalid settings are reported in the
+// returned error, the returned configuration keeps their defaults. Invoked
+// with -h, flag.ErrHelp is returned after the usage was printed.
+func LoadConfig(args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	config := DefaultConfig()
+	fields := configFields()
+
+	flags := flag.NewFlagSet("docker-mailserver-aliases", flag.ContinueOnError)
+	configFile := flags.String(configFileFlag, "", "Path of a YAML or TOML config file (env "+configFileEnv+")")
+	for _, field := range fields {
+		flags.String(field.flag(), "", fmt.Sprintf("%s (env %s)", field.usage, field.env))
+	}
+	if err := flags.Parse(args); err != nil {
+		return config, err
+	}
+	if flags.NArg() > 0 {
+		return config, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	values := make(map[string]configValue)
+	var errs []error
+
+	if *configFile == "" {
+		*configFile, _ = lookupEnv(configFileEnv)
+	}
+	if *configFile != "" {
+		fileValues, err := readConfigFile(*configFile, fields)
+		if err != nil {
+			return config, err
+		}
+		for key, value := range fileValues {
+			values[key] = value
+		}
+	}
+
+	for _, field := range fields {
+		value, ok, err := lookupEnvOrFile(lookupEnv, field.env)
+		if err != nil {
+			errs = append(errs, err)
+		} else if ok {
+			values[field.key] = configValue{value: value, source: field.env}
+		}
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name != configFileFlag {
+			values[strings.ReplaceAll(f.Name, "-", "_")] = configValue{value: f.Value.String(), source: "-" + f.Name}
+		}
+	})
+
+	target := reflect.ValueOf(&config).Elem()
+	for _, field := range fields {
+		value, ok := values[field.key]
+		if !ok || strings.TrimSpace(value.value) == "" {
+			continue
+		}
+		if err := field.set(target.Field(field.index), strings.TrimSpace(value.value)); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q: %w", value.source, value.value, err))
+		}
+	}
+
+	errs = append(errs, config.validate())
+	return config, errors.Join(errs...)
+}
+
+// configValue is the raw value of a setting and where it was read from.
+type configValue struct {
+	value  string
+	source string
+}
+
+// lookupEnvOrFile returns the value of the environment variable or the content
+// of the file named by the variable with a _FILE suffix, as used for Docker
+// secrets.
+func lookupEnvOrFile(lookupEnv func(string) (string, bool), name string) (string, bool, error) {
+	value, ok := lookupEnv(name)
+	path, fileOK := lookupEnv(name + "_FILE")
+	if !fileOK || path == "" {
+		return value, ok && value != "", nil
+	}
+	if ok && value != "" {
+		return "", false, fmt.Errorf("%s and %s_FILE must not both be set", name, name)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid %s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), true, nil
+}
+
+// readConfigFile reads the settings of a YAML or TOML file, depending on its
+// extension. Lists are joined with commas like in environment variables.
+func readConfigFile(path string, fields []configField) (map[string]configValue, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	settings := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &settings)
+	case ".toml":
+		err = toml.Unmarshal(content, &settings)
+	default:
+		return nil, fmt.Errorf("unsupported config file %s, expected .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	values := make(map[string]configValue, len(settings))
+	var errs []error
+	for key, setting := range settings {
+		if !slices.ContainsFunc(fields, func(f configField) bool { return f.key == key }) {
+			errs = append(errs, fmt.Errorf("unknown setting %q in config file %s", key, path))
+			continue
+		}
+
+		var value string
+		switch setting := setting.(type) {
+		case []any:
+			items := make([]string, 0, len(setting))
+			for _, item := range setting {
+				items = append(items, fmt.Sprint(item))
+			}
+			value = strings.Join(items, ",")
+		case map[string]any:
+			errs = append(errs, fmt.Errorf("invalid setting %q in config file %s: unexpected table", key, path))
+			continue
+		case nil:
+		default:
+			value = fmt.Sprint(setting)
+		}
+		values[key] = configValue{value: value, source: key + " in " + path}
+	}
+	return values, errors.Join(errs...)
+}
+
+// configField is a setting of Config, described by the tags of its field.
+type configField struct {
+	index  int
+	key    string
+	env    string
+	usage  string
+	check  string
+	reload bool
+	secret bool
+}
+
+func (f configField) flag() string {
+	return strings.ReplaceAll(f.key, "_", "-")
+}
+
+func configFields() []configField {
+	t := reflect.TypeFor[Config]()
+	fields := make([]configField, 0, t.NumField())
+	for i := range t.NumField() {
+		field := t.Field(i)
+		fields = append(fields, configField{
+			index:  i,
+			key:    field.Tag.Get("config"),
+			env:    field.Tag.Get("env"),
+			usage:  field.Tag.Get("usage"),
+			check:  field.Tag.Get("check"),
+			reload: field.Tag.Get("reload") == "true",
+			secret: field.Tag.Get("secret") == "true",
+		})
+	}
+	return fields
+}
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// set parses the value into the field and checks it. The field is left
+// unchanged if the value is invalid.
+func (f configField) set(field reflect.Value, value string) error {
+	if unmarshaler, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(value))
+	}
+
+	switch {
+	case field.Type() == durationType:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.New("expected a duration like 30s or 5m")
+		}
+		if err := checkNumber(f.check, int64(duration)); err != nil {
+			return err
+		}
+		field.SetInt(int64(duration))
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("expected a number")
+		}
+		if err := checkNumber(f.check, int64(n)); err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.String:
+		if f.check != "" {
+			value = strings.ToLower(value)
+			if !slices.Contains(strings.Split(f.check, "|"), value) {
+				return fmt.Errorf("expected one of %s", strings.ReplaceAll(f.check, "|", ", "))
+			}
+		}
+		field.SetString(value)
+	case field.Kind() == reflect.Slice:
+		items := make([]string, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	}
+	return nil
+}
+
+func checkNumber(check string, n int64) error {
+	switch {
+	case check == "positive" && n <= 0:
+		return errors.New("must be greater than 0")
+	case check == "nonnegative" && n < 0:
+		return errors.New("must not be negative")
+	}
+	return nil
+}
+
+// LogValue logs every setting under its config key, with the values of
+// secret settings redacted.
+func (c Config) LogValue() slog.Value {
+	value := reflect.ValueOf(c)
+	attrs := make([]slog.Attr, 0, value.NumField())
+	for _, field := range configFields() {
+		attrs = append(attrs, slog.String(field.key, formatConfigValue(field, value.Field(field.index))))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func formatConfigValue(field configField, value reflect.Value) string {
+	if field.secret {
+		if value.IsZero() {
+			return ""
+		}
+		return "[redacted]"
+	}
+	if items, ok := value.Interface().([]string); ok {
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value.Interface())
+}
+
+var currentConfig atomic.Pointer[Config]
+
+// GetConfig returns the configuration set by SetConfig. Until the application
+// has set its configuration, e.g. in tests, it is read from the environment
+// on every call, with defaults for invalid settings.
+func GetConfig() Config {
+	if config := currentConfig.Load(); config != nil {
+		return *config
+	}
+	config, _ := LoadConfig(nil, os.LookupEnv)
+	return config
+}
+
+// SetConfig replaces the configuration returned by GetConfig.
+func SetConfig(config Config) {
+	currentConfig.Store(&config)
+}
+
+// ReloadConfig loads the configuration again and applies the settings that
+// can change at runtime. The config keys of changed settings that need a
+// restart are returned, these keep their current values. If the new
+// configuration is invalid, the current configuration is kept.
+func ReloadConfig(args []string, lookupEnv func(string) (string, bool)) ([]string, error) {
+	config, err := LoadConfig(args, lookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	current := reflect.ValueOf(GetConfig())
+	reloaded := reflect.ValueOf(&config).Elem()
+	restart := make([]string, 0)
+	for _, field := range configFields() {
+		if field.reload || reflect.DeepEqual(current.Field(field.index).Interface(), reloaded.Field(field.index).Interface()) {
+			continue
+		}
+		reloaded.Field(field.index).Set(current.Field(field.index))
+		restart = append(restart, field.key)
+	}
+
+	SetConfig(config)
+	return restart, nil
+}
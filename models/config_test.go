@@ -0,0 +1,261 @@
+package models
+
+import (
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func lookupEnvFrom(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("LoadConfig should return the defaults", func(t *testing.T) {
+		config, err := LoadConfig(nil, lookupEnvFrom(nil))
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultConfig(), config)
+	})
+
+	t.Run("LoadConfig should prefer flags over environment over config file", func(t *testing.T) {
+		file := writeFile(t, "config.yaml", "cache_ttl: 1m\nlist_timeout: 1m\nreadiness_timeout: 1m\n")
+		env := map[string]string{"CONFIG_FILE": file, "LIST_TIMEOUT": "2m", "READINESS_TIMEOUT": "2m"}
+
+		config, err := LoadConfig([]string{"-readiness-timeout", "3m"}, lookupEnvFrom(env))
+		assert.NoError(t, err)
+		assert.Equal(t, time.Minute, config.CacheTTL)
+		assert.Equal(t, 2*time.Minute, config.ListTimeout)
+		assert.Equal(t, 3*time.Minute, config.ReadinessTimeout)
+	})
+
+	t.Run("LoadConfig should read YAML and TOML files", func(t *testing.T) {
+		yamlFile := writeFile(t, "config.yml", "addr: :9090\nalias_max_depth: 3\nmail_domains:\n  - example.com\n  - website.de\n")
+		config, err := LoadConfig([]string{"-config", yamlFile}, lookupEnvFrom(nil))
+		assert.NoError(t, err)
+		assert.Equal(t, ":9090", config.Addr)
+		assert.Equal(t, 3, config.AliasMaxDepth)
+		assert.Equal(t, []string{"example.com", "website.de"}, config.MailDomains)
+
+		tomlFile := writeFile(t, "config.toml", "log_level = \"debug\"\nlog_format = \"JSON\"\nmail_domains = \"example.com\"\n")
+		config, err = LoadConfig([]string{"-config", tomlFile}, lookupEnvFrom(nil))
+		assert.NoError(t, err)
+		assert.Equal(t, slog.LevelDebug, config.LogLevel)
+		assert.Equal(t, "json", config.LogFormat)
+		assert.Equal(t, []string{"example.com"}, config.MailDomains)
+	})
+
+	t.Run("LoadConfig should reject unknown settings and file types", func(t *testing.T) {
+		_, err := LoadConfig([]string{"-config", writeFile(t, "config.yaml", "cache: 1m\n")}, lookupEnvFrom(nil))
+		assert.ErrorContains(t, err, `unknown setting "cache"`)
+
+		_, err = LoadConfig([]string{"-config", writeFile(t, "config.json", "{}")}, lookupEnvFrom(nil))
+		assert.ErrorContains(t, err, "unsupported config file")
+	})
+
+	t.Run("LoadConfig should read _FILE variables", func(t *testing.T) {
+		secret := writeFile(t, "lock_file", "/run/lock/aliases\n")
+
+		config, err := LoadConfig(nil, lookupEnvFrom(map[string]string{"LOCK_FILE_FILE": secret}))
+		assert.NoError(t, err)
+		assert.Equal(t, "/run/lock/aliases", config.LockFile)
+
+		_, err = LoadConfig(nil, lookupEnvFrom(map[string]string{"LOCK_FILE_FILE": secret, "LOCK_FILE": "/tmp/lock"}))
+		assert.EqualError(t, err, "LOCK_FILE and LOCK_FILE_FILE must not both be set")
+	})
+
+	t.Run("LoadConfig should report all invalid settings and keep their defaults", func(t *testing.T) {
+		env := map[string]string{"CACHE_TTL": "soon", "ALIAS_MAX_DEPTH": "0", "LOG_FORMAT": "xml"}
+
+		config, err := LoadConfig([]string{"-lock-timeout", "-1s"}, lookupEnvFrom(env))
+		assert.ErrorContains(t, err, `invalid CACHE_TTL "soon": expected a duration like 30s or 5m`)
+		assert.ErrorContains(t, err, `invalid ALIAS_MAX_DEPTH "0": must be greater than 0`)
+		assert.ErrorContains(t, err, `invalid LOG_FORMAT "xml": expected one of text, json`)
+		assert.ErrorContains(t, err, `invalid -lock-timeout "-1s": must be greater than 0`)
+		assert.Equal(t, DefaultConfig(), config)
+	})
+
+	t.Run("LoadConfig should check the TLS settings together", func(t *testing.T) {
+		_, err := LoadConfig([]string{"-tls-cert-path", "cert.pem", "-http-redirect-addr", ":80"}, lookupEnvFrom(nil))
+		assert.ErrorContains(t, err, "TLS_CERT_PATH and TLS_KEY_PATH must be set together")
+		assert.ErrorContains(t, err, "HTTP_REDIRECT_ADDR requires TLS_CERT_PATH and TLS_KEY_PATH")
+
+		config, err := LoadConfig([]string{"-tls-cert-path", "cert.pem", "-tls-key-path", "key.pem", "-tls-min-version", "1.3"}, lookupEnvFrom(nil))
+		assert.NoError(t, err)
+		assert.True(t, config.TLSEnabled())
+		assert.Equal(t, "1.3", config.TLSMinVersion)
+	})
+
+	t.Run("LoadConfig should require forward authentication for API tokens", func(t *testing.T) {
+		_, err := LoadConfig([]string{"-api-token-file", "tokens.json"}, lookupEnvFrom(nil))
+		assert.EqualError(t, err, "API_TOKEN_FILE requires FORWARD_AUTH_PROXIES, otherwise requests without a token would not be limited")
+
+		_, err = LoadConfig([]string{"-api-token-file", "tokens.json", "-forward-auth-proxies", "10.0.0.1"}, lookupEnvFrom(nil))
+		assert.NoError(t, err)
+	})
+
+	t.Run("LoadConfig should require a write timeout longer than changes", func(t *testing.T) {
+		_, err := LoadConfig([]string{"-change-timeout", "2m", "-shutdown-timeout", "3m"}, lookupEnvFrom(nil))
+		assert.EqualError(t, err, "WRITE_TIMEOUT must be longer than CHANGE_TIMEOUT plus LOCK_TIMEOUT, or 0")
+
+		_, err = LoadConfig([]string{"-change-timeout", "2m", "-write-timeout", "0", "-shutdown-timeout", "3m"}, lookupEnvFrom(nil))
+		assert.NoError(t, err)
+	})
+
+	t.Run("LoadConfig should require a shutdown timeout longer than changes", func(t *testing.T) {
+		_, err := LoadConfig([]string{"-shutdown-timeout", "1m"}, lookupEnvFrom(nil))
+		assert.EqualError(t, err, "SHUTDOWN_TIMEOUT must be longer than CHANGE_TIMEOUT plus LOCK_TIMEOUT")
+
+		_, err = LoadConfig([]string{"-shutdown-timeout", "1m", "-change-timeout", "30s"}, lookupEnvFrom(nil))
+		assert.NoError(t, err)
+	})
+
+	t.Run("LoadConfig should read rate limits and trusted proxies", func(t *testing.T) {
+		env := map[string]string{"RATE_LIMIT": "5/10s", "MUTATION_RATE_LIMIT": "off", "TRUSTED_PROXIES": "172.16.0.0/12, 10.0.0.1"}
+
+		config, err := LoadConfig(nil, lookupEnvFrom(env))
+		assert.NoError(t, err)
+		assert.Equal(t, Rate{Count: 5, Per: 10 * time.Second}, config.RateLimit)
+		assert.Equal(t, Rate{}, config.MutationRateLimit)
+		assert.Equal(t, []string{"172.16.0.0/12", "10.0.0.1"}, config.TrustedProxies)
+
+		_, err = LoadConfig(nil, lookupEnvFrom(map[string]string{"RATE_LIMIT": "fast", "TRUSTED_PROXIES": "proxy"}))
+		assert.ErrorContains(t, err, `invalid RATE_LIMIT "fast"`)
+		assert.ErrorContains(t, err, `invalid TRUSTED_PROXIES "proxy"`)
+	})
+
+	t.Run("LoadConfig should check the CORS origins", func(t *testing.T) {
+		config, err := LoadConfig([]string{"-cors-allowed-origins", "https://tools.example.com,http://localhost:5173"}, lookupEnvFrom(nil))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"https://tools.example.com", "http://localhost:5173"}, config.CORSAllowedOrigins)
+
+		for _, origin := range []string{"*", "tools.example.com", "https://tools.example.com/", "ftp://example.com"} {
+			_, err := LoadConfig(nil, lookupEnvFrom(map[string]string{"CORS_ALLOWED_ORIGINS": origin}))
+			assert.ErrorContains(t, err, "invalid CORS_ALLOWED_ORIGINS", origin)
+		}
+	})
+
+	t.Run("LoadConfig should check the forward authentication settings", func(t *testing.T) {
+		config, err := LoadConfig([]string{"-forward-auth-proxies", "172.16.0.0/12"}, lookupEnvFrom(nil))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"172.16.0.0/12"}, config.ForwardAuthProxies)
+		assert.Equal(t, "Remote-User", config.ForwardAuthUser)
+		assert.Equal(t, "Remote-Groups", config.ForwardAuthGroups)
+
+		_, err = LoadConfig([]string{"-forward-auth-proxies", "authelia"}, lookupEnvFrom(nil))
+		assert.EqualError(t, err, `invalid FORWARD_AUTH_PROXIES "authelia": expected an IP address or CIDR`)
+	})
+
+	t.Run("LoadConfig should read the OTLP exporter settings", func(t *testing.T) {
+		env := map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://otel-collector:4318/", "OTEL_EXPORTER_OTLP_HEADERS": "api-key=s3cret, x-tenant=a%2Cb"}
+
+		config, err := LoadConfig(nil, lookupEnvFrom(env))
+		assert.NoError(t, err)
+		assert.Equal(t, "http://otel-collector:4318/v1/traces", config.OTLPTracesURL())
+		headers, err := parseOTLPHeaders(config.OTLPHeaders)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"api-key": "s3cret", "x-tenant": "a,b"}, headers)
+
+		config, err = LoadConfig([]string{"-otel-exporter-otlp-traces-endpoint", "https://example.com/traces"}, lookupEnvFrom(env))
+		assert.NoError(t, err)
+		assert.Equal(t, "https://example.com/traces", config.OTLPTracesURL())
+		assert.Empty(t, DefaultConfig().OTLPTracesURL())
+
+		_, err = LoadConfig(nil, lookupEnvFrom(map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "otel-collector:4318", "OTEL_EXPORTER_OTLP_HEADERS": "s3cret"}))
+		assert.ErrorContains(t, err, `invalid OTEL_EXPORTER_OTLP_ENDPOINT "otel-collector:4318"`)
+		assert.ErrorContains(t, err, "invalid OTEL_EXPORTER_OTLP_HEADERS: expected comma-separated key=value pairs")
+		assert.NotContains(t, err.Error(), "s3cret")
+	})
+
+	t.Run("LoadConfig should return flag.ErrHelp for -h", func(t *testing.T) {
+		stderr := os.Stderr
+		os.Stderr, _ = os.Open(os.DevNull)
+		t.Cleanup(func() { os.Stderr = stderr })
+
+		_, err := LoadConfig([]string{"-h"}, lookupEnvFrom(nil))
+		assert.True(t, errors.Is(err, flag.ErrHelp))
+	})
+}
+
+func TestConfigLogValue(t *testing.T) {
+	t.Run("LogValue should log every setting", func(t *testing.T) {
+		var out strings.Builder
+		logger := slog.New(slog.NewTextHandler(&out, nil))
+		logger.Info("config", slog.Any("config", DefaultConfig()))
+
+		assert.Contains(t, out.String(), "config.addr=:8080")
+		assert.Contains(t, out.String(), "config.cache_ttl=30s")
+		assert.Contains(t, out.String(), "config.log_level=INFO")
+	})
+
+	t.Run("LogValue should redact the OTLP headers", func(t *testing.T) {
+		config, err := LoadConfig(nil, lookupEnvFrom(map[string]string{"OTEL_EXPORTER_OTLP_HEADERS": "api-key=s3cret"}))
+		assert.NoError(t, err)
+
+		var out strings.Builder
+		logger := slog.New(slog.NewJSONHandler(&out, nil))
+		logger.Info("config", slog.Any("config", config))
+
+		assert.Contains(t, out.String(), `"otel_exporter_otlp_headers":"[redacted]"`)
+		assert.NotContains(t, out.String(), "s3cret")
+	})
+
+	t.Run("formatConfigValue should redact secrets", func(t *testing.T) {
+		field := configField{key: "token", secret: true}
+		assert.Equal(t, "[redacted]", formatConfigValue(field, reflect.ValueOf("s3cret")))
+		assert.Equal(t, "", formatConfigValue(field, reflect.ValueOf("")))
+		assert.Equal(t, "a,b", formatConfigValue(configField{}, reflect.ValueOf([]string{"a", "b"})))
+	})
+}
+
+func TestReloadConfig(t *testing.T) {
+	t.Cleanup(func() { currentConfig.Store(nil) })
+	SetConfig(DefaultConfig())
+
+	t.Run("ReloadConfig should keep settings that need a restart", func(t *testing.T) {
+		env := map[string]string{"GIN_ADDR": ":9090", "CACHE_TTL": "1m"}
+
+		restart, err := ReloadConfig(nil, lookupEnvFrom(env))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"addr"}, restart)
+		assert.Equal(t, ":8080", GetAddr())
+		assert.Equal(t, time.Minute, GetCacheTTL())
+	})
+
+	t.Run("ReloadConfig should keep the configuration if the new one is invalid", func(t *testing.T) {
+		_, err := ReloadConfig(nil, lookupEnvFrom(map[string]string{"CACHE_TTL": "2m", "LOCK_TIMEOUT": "never"}))
+		assert.Error(t, err)
+		assert.Equal(t, time.Minute, GetCacheTTL())
+	})
+}
+
+func TestRate(t *testing.T) {
+	for _, value := range []string{"10/s", "30/m", "1000/h", "5/10s", "off"} {
+		var rate Rate
+		assert.NoError(t, rate.UnmarshalText([]byte(value)), value)
+		assert.Equal(t, value, rate.String())
+	}
+
+	for _, value := range []string{"10", "0/s", "-1/m", "10/day", "ten/s"} {
+		var rate Rate
+		assert.Error(t, rate.UnmarshalText([]byte(value)), value)
+	}
+}
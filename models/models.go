@@ -1,31 +1,263 @@
 package models
 
-import "os"
+import (
+	"log/slog"
+	"strings"
+	"time"
+)
+
+func GetAddr() string {
+	return GetConfig().Addr
+}
 
 func GetDockerImage() string {
-	if image := os.Getenv("DOCKER_MAILSERVER_IMAGE"); image != "" {
-		return image
+	return GetConfig().DockerImage
+}
+
+func GetCacheTTL() time.Duration {
+	return GetConfig().CacheTTL
+}
+
+func GetReadinessTimeout() time.Duration {
+	return GetConfig().ReadinessTimeout
+}
+
+func GetAliasMaxDepth() int {
+	return GetConfig().AliasMaxDepth
+}
+
+// GetDockerTimeout returns the deadline for Docker API calls like listing
+// and inspecting containers.
+func GetDockerTimeout() time.Duration {
+	return GetConfig().DockerTimeout
+}
+
+// GetListTimeout returns the deadline for `setup alias list` and
+// `setup email list`.
+func GetListTimeout() time.Duration {
+	return GetConfig().ListTimeout
+}
+
+// GetChangeTimeout returns the deadline for setup commands changing the
+// mailserver, like `setup alias add`.
+func GetChangeTimeout() time.Duration {
+	return GetConfig().ChangeTimeout
+}
+
+func GetDanglingCheckInterval() time.Duration {
+	return GetConfig().DanglingCheckInterval
+}
+
+// GetMailDomains returns the domains of MAIL_DOMAINS, which are hosted by
+// the mailserver in addition to the domains of its mailboxes.
+func GetMailDomains() []string {
+	domains := make([]string, 0)
+	for _, domain := range GetConfig().MailDomains {
+		domains = append(domains, strings.ToLower(domain))
 	}
-	return "mailserver/docker-mailserver"
+	return domains
+}
+
+// GetLockFile returns the path of the file locked during changes to the
+// mailserver, to serialize them across processes. Empty if not configured.
+func GetLockFile() string {
+	return GetConfig().LockFile
+}
+
+func GetLockTimeout() time.Duration {
+	return GetConfig().LockTimeout
+}
+
+func GetIdempotencyTTL() time.Duration {
+	return GetConfig().IdempotencyTTL
+}
+
+// GetMaxBodySize returns the maximum size of request bodies in bytes.
+func GetMaxBodySize() int64 {
+	return int64(GetConfig().MaxBodySize)
+}
+
+func GetRateLimit() Rate {
+	return GetConfig().RateLimit
+}
+
+func GetMutationRateLimit() Rate {
+	return GetConfig().MutationRateLimit
+}
+
+func GetAuthFailureRateLimit() Rate {
+	return GetConfig().AuthFailureRateLimit
+}
+
+func GetCORSAllowedOrigins() []string {
+	return GetConfig().CORSAllowedOrigins
+}
+
+func GetForwardAuthProxies() []string {
+	return GetConfig().ForwardAuthProxies
+}
+
+func GetForwardAuthUserHeader() string {
+	return GetConfig().ForwardAuthUser
+}
+
+func GetForwardAuthGroupsHeader() string {
+	return GetConfig().ForwardAuthGroups
+}
+
+func GetLogLevel() slog.Level {
+	return GetConfig().LogLevel
+}
+
+func GetLogFormat() string {
+	return GetConfig().LogFormat
+}
+
+func GetOTLPTracesURL() string {
+	return GetConfig().OTLPTracesURL()
+}
+
+// GetOTLPHeaders returns the headers sent to the OTLP collector. The headers
+// are checked when the configuration is loaded.
+func GetOTLPHeaders() map[string]string {
+	headers, _ := parseOTLPHeaders(GetConfig().OTLPHeaders)
+	return headers
 }
 
 type StatusResponse struct {
-	Running bool `json:"running"`
+	Running            bool   `json:"running"`
+	Health             string `json:"health,omitempty"`
+	Name               string `json:"name,omitempty"`
+	ID                 string `json:"id,omitempty"`
+	Image              string `json:"image,omitempty"`
+	Tag                string `json:"tag,omitempty"`
+	StartedAt          string `json:"started_at,omitempty"`
+	UptimeSeconds      int64  `json:"uptime_seconds,omitempty"`
+	RestartCount       int    `json:"restart_count,omitempty"`
+	Version            string `json:"version,omitempty"`
+	AccountProvisioner string `json:"account_provisioner,omitempty"`
+	Mailboxes          *int   `json:"mailboxes,omitempty"`
+	Aliases            *int   `json:"aliases,omitempty"`
+	DanglingAliases    *int   `json:"dangling_aliases,omitempty"`
 }
 
 type ErrorResponse struct {
 	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+type DomainListResponse struct {
+	Domains []string `json:"domains"`
 }
 
 type EmailListResponse struct {
 	Emails []string `json:"emails"`
+	Total  int      `json:"total"`
+	Limit  int      `json:"limit,omitempty"`
+	Offset int      `json:"offset,omitempty"`
 }
 
 type AliasListResponse struct {
 	Aliases []AliasResponse `json:"aliases"`
+	Total   int             `json:"total"`
+	Limit   int             `json:"limit,omitempty"`
+	Offset  int             `json:"offset,omitempty"`
+}
+
+type MailboxAliasesResponse struct {
+	Email   string              `json:"email"`
+	Aliases []AliasPathResponse `json:"aliases"`
+}
+
+// AliasPathResponse is an alias reaching a mailbox, with the addresses from
+// the alias to the mailbox in Path.
+type AliasPathResponse struct {
+	Alias string   `json:"alias"`
+	Path  []string `json:"path"`
+}
+
+type AliasCyclesResponse struct {
+	Cycles [][]string `json:"cycles"`
+}
+
+// DanglingAliasResponse is an alias whose chain ends at the address Missing,
+// which is neither a mailbox nor an alias of a hosted domain.
+type DanglingAliasResponse struct {
+	Alias   string   `json:"alias"`
+	Email   string   `json:"email"`
+	Missing string   `json:"missing"`
+	Path    []string `json:"path"`
+}
+
+type DanglingAliasesResponse struct {
+	Aliases []DanglingAliasResponse `json:"aliases"`
+}
+
+type DanglingCleanupRequest struct {
+	Action  string   `json:"action" binding:"required,oneof=delete retarget"`
+	Email   string   `json:"email"`
+	Aliases []string `json:"aliases"`
+}
+
+type DanglingCleanupResponse struct {
+	Updated []AliasResponse       `json:"updated"`
+	Failed  []AliasFailedResponse `json:"failed"`
+}
+
+type AliasFailedResponse struct {
+	Alias string `json:"alias"`
+	Error string `json:"error"`
 }
 
 type AliasResponse struct {
 	Alias string `json:"alias"`
 	Email string `json:"email"`
 }
+
+type EventResponse struct {
+	Type   string          `json:"type"`
+	Alias  *AliasResponse  `json:"alias,omitempty"`
+	Status *StatusResponse `json:"status,omitempty"`
+}
+
+type HealthResponse struct {
+	Status string                `json:"status"`
+	Checks []HealthCheckResponse `json:"checks,omitempty"`
+}
+
+type HealthCheckResponse struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// APITokenRequest creates an API token with the scopes read and
+// aliases-write. Domains limit the changes of the token to aliases of these
+// domains, an empty list allows all domains.
+type APITokenRequest struct {
+	Name    string   `json:"name" binding:"required,max=100"`
+	Scopes  []string `json:"scopes" binding:"required,min=1,dive,oneof=read aliases-write"`
+	Domains []string `json:"domains"`
+}
+
+type APITokenResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Domains    []string   `json:"domains"`
+	CreatedAt  time.Time  `json:"created_at"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// APITokenCreatedResponse is the created API token. The token itself is only
+// returned once and cannot be retrieved later.
+type APITokenCreatedResponse struct {
+	APITokenResponse
+	Token string `json:"token"`
+}
+
+type APITokenListResponse struct {
+	Tokens []APITokenResponse `json:"tokens"`
+}
@@ -2,8 +2,10 @@ package models
 
 import (
 	"encoding/json"
+	"log/slog"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -49,11 +51,11 @@ func TestErrorResponseMarshalling(t *testing.T) {
 }
 
 func TestEmailListResponseMarshalling(t *testing.T) {
-	original := EmailListResponse{Emails: []string{"user1@example.com", "user2@example.com"}}
+	original := EmailListResponse{Emails: []string{"user1@example.com", "user2@example.com"}, Total: 2}
 	data, err := json.Marshal(original)
 	assert.NoError(t, err, "Marshalling EmailListResponse should not return an error")
 
-	expectedJSON := `{"emails":["user1@example.com","user2@example.com"]}`
+	expectedJSON := `{"emails":["user1@example.com","user2@example.com"],"total":2}`
 	assert.JSONEq(t, expectedJSON, string(data), "Marshalled JSON should match expected")
 
 	var unmarshalled EmailListResponse
@@ -82,11 +84,12 @@ func TestAliasListResponseMarshalling(t *testing.T) {
 			{Alias: "alias1@example.com", Email: "user1@example.com"},
 			{Alias: "alias2@example.com", Email: "user2@example.com"},
 		},
+		Total: 2,
 	}
 	data, err := json.Marshal(original)
 	assert.NoError(t, err, "Marshalling AliasListResponse should not return an error")
 
-	expectedJSON := `{"aliases":[{"alias":"alias1@example.com","email":"user1@example.com"},{"alias":"alias2@example.com","email":"user2@example.com"}]}`
+	expectedJSON := `{"aliases":[{"alias":"alias1@example.com","email":"user1@example.com"},{"alias":"alias2@example.com","email":"user2@example.com"}],"total":2}`
 	assert.JSONEq(t, expectedJSON, string(data), "Marshalled JSON should match expected")
 
 	var unmarshalled AliasListResponse
@@ -94,3 +97,109 @@ func TestAliasListResponseMarshalling(t *testing.T) {
 	assert.NoError(t, err, "Unmarshalling AliasListResponse should not return an error")
 	assert.Equal(t, original, unmarshalled, "Unmarshalled AliasListResponse should match original")
 }
+
+func TestGetAliasMaxDepthDefault(t *testing.T) {
+	assert.Equal(t, 10, GetAliasMaxDepth(), "GetAliasMaxDepth should return the default value when no environment variable is set")
+}
+
+func TestGetAliasMaxDepthFromEnv(t *testing.T) {
+	os.Setenv("ALIAS_MAX_DEPTH", "3")
+	defer os.Unsetenv("ALIAS_MAX_DEPTH")
+
+	assert.Equal(t, 3, GetAliasMaxDepth(), "GetAliasMaxDepth should return the environment variable value when set")
+
+	os.Setenv("ALIAS_MAX_DEPTH", "0")
+	assert.Equal(t, 10, GetAliasMaxDepth(), "GetAliasMaxDepth should ignore values below 1")
+}
+
+func TestGetDanglingCheckInterval(t *testing.T) {
+	assert.Equal(t, time.Hour, GetDanglingCheckInterval(), "GetDanglingCheckInterval should return the default value when no environment variable is set")
+
+	os.Setenv("DANGLING_CHECK_INTERVAL", "0")
+	defer os.Unsetenv("DANGLING_CHECK_INTERVAL")
+	assert.Equal(t, time.Duration(0), GetDanglingCheckInterval(), "GetDanglingCheckInterval should allow disabling the check")
+
+	os.Setenv("DANGLING_CHECK_INTERVAL", "invalid")
+	assert.Equal(t, time.Hour, GetDanglingCheckInterval(), "GetDanglingCheckInterval should ignore invalid values")
+}
+
+func TestGetMailDomains(t *testing.T) {
+	assert.Equal(t, []string{}, GetMailDomains(), "GetMailDomains should return no domains when no environment variable is set")
+
+	os.Setenv("MAIL_DOMAINS", "Example.com, website.de,,")
+	defer os.Unsetenv("MAIL_DOMAINS")
+	assert.Equal(t, []string{"example.com", "website.de"}, GetMailDomains(), "GetMailDomains should return the lowercased domains")
+}
+
+func TestGetLockTimeout(t *testing.T) {
+	assert.Equal(t, 10*time.Second, GetLockTimeout(), "GetLockTimeout should return the default value when no environment variable is set")
+
+	os.Setenv("LOCK_TIMEOUT", "500ms")
+	defer os.Unsetenv("LOCK_TIMEOUT")
+	assert.Equal(t, 500*time.Millisecond, GetLockTimeout(), "GetLockTimeout should return the environment variable value when set")
+
+	os.Setenv("LOCK_TIMEOUT", "0")
+	assert.Equal(t, 10*time.Second, GetLockTimeout(), "GetLockTimeout should ignore values that are not positive")
+}
+
+func TestGetIdempotencyTTL(t *testing.T) {
+	assert.Equal(t, 24*time.Hour, GetIdempotencyTTL(), "GetIdempotencyTTL should return the default value when no environment variable is set")
+
+	os.Setenv("IDEMPOTENCY_TTL", "1h")
+	defer os.Unsetenv("IDEMPOTENCY_TTL")
+	assert.Equal(t, time.Hour, GetIdempotencyTTL(), "GetIdempotencyTTL should return the environment variable value when set")
+}
+
+func TestGetOperationTimeouts(t *testing.T) {
+	assert.Equal(t, 5*time.Second, GetDockerTimeout(), "GetDockerTimeout should return the default value when no environment variable is set")
+	assert.Equal(t, 30*time.Second, GetListTimeout(), "GetListTimeout should return the default value when no environment variable is set")
+	assert.Equal(t, time.Minute, GetChangeTimeout(), "GetChangeTimeout should return the default value when no environment variable is set")
+
+	os.Setenv("DOCKER_TIMEOUT", "2s")
+	os.Setenv("LIST_TIMEOUT", "10s")
+	os.Setenv("CHANGE_TIMEOUT", "-1s")
+	defer os.Unsetenv("DOCKER_TIMEOUT")
+	defer os.Unsetenv("LIST_TIMEOUT")
+	defer os.Unsetenv("CHANGE_TIMEOUT")
+
+	assert.Equal(t, 2*time.Second, GetDockerTimeout(), "GetDockerTimeout should return the environment variable value when set")
+	assert.Equal(t, 10*time.Second, GetListTimeout(), "GetListTimeout should return the environment variable value when set")
+	assert.Equal(t, time.Minute, GetChangeTimeout(), "GetChangeTimeout should ignore values that are not positive")
+}
+
+func TestGetCacheTTLDefault(t *testing.T) {
+	assert.Equal(t, 30*time.Second, GetCacheTTL(), "GetCacheTTL should return the default value when no environment variable is set")
+}
+
+func TestGetCacheTTLFromEnv(t *testing.T) {
+	os.Setenv("CACHE_TTL", "2m")
+	defer os.Unsetenv("CACHE_TTL")
+
+	assert.Equal(t, 2*time.Minute, GetCacheTTL(), "GetCacheTTL should return the environment variable value when set")
+}
+
+func TestGetCacheTTLInvalid(t *testing.T) {
+	os.Setenv("CACHE_TTL", "soon")
+	defer os.Unsetenv("CACHE_TTL")
+
+	assert.Equal(t, 30*time.Second, GetCacheTTL(), "GetCacheTTL should fall back to the default value for invalid durations")
+}
+
+func TestGetLogLevel(t *testing.T) {
+	assert.Equal(t, slog.LevelInfo, GetLogLevel(), "GetLogLevel should default to info")
+
+	os.Setenv("LOG_LEVEL", "debug")
+	defer os.Unsetenv("LOG_LEVEL")
+	assert.Equal(t, slog.LevelDebug, GetLogLevel(), "GetLogLevel should return the environment variable value when set")
+
+	os.Setenv("LOG_LEVEL", "verbose")
+	assert.Equal(t, slog.LevelInfo, GetLogLevel(), "GetLogLevel should fall back to info for unknown levels")
+}
+
+func TestGetLogFormat(t *testing.T) {
+	assert.Equal(t, "text", GetLogFormat(), "GetLogFormat should default to text")
+
+	os.Setenv("LOG_FORMAT", "JSON")
+	defer os.Unsetenv("LOG_FORMAT")
+	assert.Equal(t, "json", GetLogFormat(), "GetLogFormat should return json when set")
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate is a rate limit of Count requests per period, written like "10/s",
+// "30/m", "1000/h" or "5/10s". The zero Rate, written "off", disables the
+// limit.
+type Rate struct {
+	Count int
+	Per   time.Duration
+}
+
+func (r *Rate) UnmarshalText(text []byte) error {
+	value := strings.ToLower(strings.TrimSpace(string(text)))
+	if value == "off" || value == "0" {
+		*r = Rate{}
+		return nil
+	}
+
+	count, per, found := strings.Cut(value, "/")
+	n, err := strconv.Atoi(count)
+	if !found || err != nil || n <= 0 {
+		return errors.New(`expected a rate like "10/s", "30/m" or "off"`)
+	}
+
+	var duration time.Duration
+	switch per {
+	case "s":
+		duration = time.Second
+	case "m":
+		duration = time.Minute
+	case "h":
+		duration = time.Hour
+	default:
+		duration, err = time.ParseDuration(per)
+		if err != nil || duration <= 0 {
+			return errors.New(`expected a rate like "10/s", "30/m" or "off"`)
+		}
+	}
+
+	*r = Rate{Count: n, Per: duration}
+	return nil
+}
+
+func (r Rate) String() string {
+	switch {
+	case r.Count == 0:
+		return "off"
+	case r.Per == time.Second:
+		return strconv.Itoa(r.Count) + "/s"
+	case r.Per == time.Minute:
+		return strconv.Itoa(r.Count) + "/m"
+	case r.Per == time.Hour:
+		return strconv.Itoa(r.Count) + "/h"
+	}
+	return strconv.Itoa(r.Count) + "/" + r.Per.String()
+}
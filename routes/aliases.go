@@ -1,66 +1,144 @@
 package routes
 
 import (
-	"bytes"
 	"context"
 	"errors"
-	"io"
 	"net/mail"
 	"regexp"
+	"slices"
 	"strings"
 
-	"github.com/docker/docker/api/types/container"
 	"github.com/gin-gonic/gin"
 	"github.com/scheidti/docker-mailserver-aliases/models"
 )
 
+// errorCodeAliasIsMailbox is returned when an alias would shadow a mailbox.
+const errorCodeAliasIsMailbox = "alias_is_mailbox"
+
+// errorCodeAliasExists is returned when an alias already forwards to another
+// address.
+const errorCodeAliasExists = "alias_exists"
+
+// errAliasNotFound is returned by checkIfAliasExists for unknown aliases.
+var errAliasNotFound = errors.New("Alias not found")
+
 // AliasesGetHandler godoc
 //
 //	@Summary	List of all available email aliases
 //	@Schemes
-//	@Description	Gets a list of all available email aliases from the Docker Mailserver container
+//	@Description	Gets a list of all available email aliases from the Docker Mailserver container, optionally searched, filtered, sorted and paginated
 //	@Tags			Aliases
 //	@Accept			json
 //	@Produce		json
-//	@Success		200	{object}	models.AliasListResponse
+//	@Param			fresh			query		bool	false	"Bypass the cache and read the aliases from the container"
+//	@Param			q				query		string	false	"Search alias and destination, as substring or glob with * and ?"
+//	@Param			domain			query		string	false	"Only aliases of this domain"
+//	@Param			email			query		string	false	"Only aliases forwarding to this mailbox"
+//	@Param			sort			query		string	false	"Sort field"							Enums(alias, email, domain)	default(alias)
+//	@Param			order			query		string	false	"Sort order"							Enums(asc, desc)			default(asc)
+//	@Param			limit			query		int		false	"Maximum number of aliases, 0 for all"	maximum(1000)
+//	@Param			offset			query		int		false	"Number of aliases to skip"
+//	@Param			If-None-Match	header		string	false	"ETag of the alias set known to the client"
+//	@Success		200				{object}	models.AliasListResponse
+//	@Header			200				{string}	ETag	"ETag of all aliases readable by the request, independent of filters and pagination"
+//	@Success		304
+//	@Failure		400	{object}	models.ErrorResponse
 //	@Failure		500	{object}	models.ErrorResponse
+//	@Failure		503	{object}	models.ErrorResponse
+//	@Failure		504	{object}	models.ErrorResponse
+//	@Failure		429	{object}	models.ErrorResponse
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
 //	@Router			/v1/aliases [get]
-func AliasesGetHandler(c *gin.Context) {
-	cli, err := getDockerClient()
+func (h *Handler) AliasesGetHandler(c *gin.Context) {
+	options, err := parseListOptions(c, "alias", "email", "domain")
+	if err != nil {
+		c.JSON(400, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	container, err := getMailserverContainer(ctx, h.docker)
+	if err != nil {
+		c.JSON(containerErrorStatus(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	aliases, err := mailserverCache.getAliases(ctx, h.docker, container.ID, c.Query("fresh") == "true")
 	if err != nil {
-		c.JSON(500, models.ErrorResponse{Error: err.Error()})
+		c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	visible := filterAllowedDomains(ctx, aliases.Aliases, aliasAddress)
+	etag := aliasesETag(visible)
+	c.Header("ETag", etag)
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+		c.Status(304)
 		return
 	}
-	defer cli.Close()
+	c.JSON(200, listAliases(visible, options))
+}
 
-	container, err := getMailserverContainer(cli)
+// AliasCyclesGetHandler godoc
+//
+//	@Summary	Loops of email aliases
+//	@Schemes
+//	@Description	Gets all loops of aliases forwarding to each other, which Postfix cannot deliver
+//	@Tags			Aliases
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	models.AliasCyclesResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Failure		503	{object}	models.ErrorResponse
+//	@Failure		504	{object}	models.ErrorResponse
+//	@Failure		429	{object}	models.ErrorResponse
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Router			/v1/aliases/cycles [get]
+func (h *Handler) AliasCyclesGetHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	container, err := getMailserverContainer(ctx, h.docker)
 	if err != nil {
-		c.JSON(500, models.ErrorResponse{Error: err.Error()})
+		c.JSON(containerErrorStatus(err), models.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	aliases, err := getAliases(cli, container.ID)
+	aliases, err := mailserverCache.getAliases(ctx, h.docker, container.ID, false)
 	if err != nil {
-		c.JSON(500, models.ErrorResponse{Error: err.Error()})
+		c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
 		return
 	}
-	c.JSON(200, aliases)
+	c.JSON(200, models.AliasCyclesResponse{Cycles: findAliasCycles(filterAllowedDomains(ctx, aliases.Aliases, aliasAddress))})
 }
 
 // AliasesPostHandler godoc
 //
 //	@Summary	Add a new email alias
 //	@Schemes
-//	@Description	Adds a new email alias to the Docker Mailserver container
+//	@Description	Adds a new email alias to the Docker Mailserver container. The alias must be on a hosted domain, must not be the address of a mailbox (error code alias_is_mailbox) and must not create a loop or a chain of more than ALIAS_MAX_DEPTH aliases. If the alias already exists with the same destination, it is returned with 200, if it forwards to another address, the request fails with 409 (error code alias_exists).
 //	@Tags			Aliases
 //	@Accept			json
 //	@Produce		json
-//	@Param			alias	body		models.AliasResponse	true	"Alias to add"
-//	@Success		201		{object}	models.AliasResponse
-//	@Failure		500		{object}	models.ErrorResponse
-//	@Failure		400		{object}	models.ErrorResponse
+//	@Param			alias					body		models.AliasResponse	true	"Alias to add"
+//	@Param			allow_unknown_domain	query		bool					false	"Allow an alias on a domain that is not hosted by the mailserver"
+//	@Param			allow_mailbox_collision	query		bool					false	"Allow an alias with the address of a mailbox, which then receives no mail itself"
+//	@Param			If-Match				header		string					false	"ETag of the alias set from GET /v1/aliases, fails with 412 if the aliases were changed"
+//	@Param			Idempotency-Key			header		string					false	"Key to safely retry the request, the response is replayed for retries"
+//	@Success		201						{object}	models.AliasResponse
+//	@Success		200						{object}	models.AliasResponse
+//	@Failure		500						{object}	models.ErrorResponse
+//	@Failure		503						{object}	models.ErrorResponse
+//	@Failure		504						{object}	models.ErrorResponse
+//	@Failure		400						{object}	models.ErrorResponse
+//	@Failure		409						{object}	models.ErrorResponse
+//	@Failure		412						{object}	models.ErrorResponse
+//	@Failure		413						{object}	models.ErrorResponse
+//	@Failure		422						{object}	models.ErrorResponse
+//	@Failure		429						{object}	models.ErrorResponse
+//	@Failure		403						{object}	models.ErrorResponse
+//	@Failure		401						{object}	models.ErrorResponse
 //	@Router			/v1/aliases [post]
-func AliasesPostHandler(c *gin.Context) {
+func (h *Handler) AliasesPostHandler(c *gin.Context) {
 	var newAlias models.AliasResponse
 
 	if err := c.ShouldBindJSON(&newAlias); err != nil {
@@ -73,31 +151,74 @@ func AliasesPostHandler(c *gin.Context) {
 		c.JSON(400, models.ErrorResponse{Error: "Invalid alias"})
 		return
 	}
+	if !checkDomainAllowed(c, newAlias.Alias) {
+		return
+	}
 
-	cli, err := getDockerClient()
+	ctx := c.Request.Context()
+	container, err := getMailserverContainer(ctx, h.docker)
 	if err != nil {
-		c.JSON(500, models.ErrorResponse{Error: err.Error()})
+		c.JSON(containerErrorStatus(err), models.ErrorResponse{Error: err.Error()})
 		return
 	}
-	defer cli.Close()
 
-	container, err := getMailserverContainer(cli)
+	unlock, err := mailserverLock.acquire(ctx, container.ID, models.GetLockTimeout())
 	if err != nil {
-		c.JSON(500, models.ErrorResponse{Error: err.Error()})
+		c.JSON(lockErrorStatus(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	defer unlock()
+
+	if !checkIfMatch(c, h.docker, container.ID) {
 		return
 	}
 
-	_, err = checkIfAliasExists(cli, container.ID, newAlias.Alias)
+	existingAlias, err := checkIfAliasExists(ctx, h.docker, container.ID, newAlias.Alias)
+	if err != nil && !errors.Is(err, errAliasNotFound) {
+		c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
 	if err == nil {
-		c.JSON(500, models.ErrorResponse{Error: "Alias already exists"})
+		// A retry of an add whose response got lost, e.g. after a timeout
+		if strings.EqualFold(existingAlias.Email, newAlias.Email) {
+			c.JSON(200, existingAlias)
+			return
+		}
+		c.JSON(409, models.ErrorResponse{Error: "Alias already exists", Code: errorCodeAliasExists})
 		return
 	}
 
-	emailExists, err := checkIfEmailExists(cli, container.ID, newAlias.Email)
-	_, aliasExistsErr := checkIfAliasExists(cli, container.ID, newAlias.Email)
+	if c.Query("allow_unknown_domain") != "true" {
+		emails, err := mailserverCache.getEmails(ctx, h.docker, container.ID, false)
+		if err != nil {
+			c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		if !isHostedDomain(hostedDomains(emails), newAlias.Alias) {
+			c.JSON(400, models.ErrorResponse{Error: "Domain " + domainOf(newAlias.Alias) + " is not hosted by the mailserver"})
+			return
+		}
+	}
+
+	if c.Query("allow_mailbox_collision") != "true" {
+		isMailbox, err := checkIfAliasIsMailbox(ctx, h.docker, container.ID, newAlias.Alias)
+		if err != nil {
+			c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		if isMailbox {
+			c.JSON(409, models.ErrorResponse{Error: "Alias is already a mailbox", Code: errorCodeAliasIsMailbox})
+			return
+		}
+	}
+
+	emailExists, err := checkIfEmailExists(ctx, h.docker, container.ID, newAlias.Email)
+	_, aliasExistsErr := checkIfAliasExists(ctx, h.docker, container.ID, newAlias.Email)
 
 	if err != nil {
-		c.JSON(500, models.ErrorResponse{Error: err.Error()})
+		c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
 		return
 	}
 
@@ -106,12 +227,25 @@ func AliasesPostHandler(c *gin.Context) {
 		return
 	}
 
-	err = addAlias(cli, container.ID, newAlias)
+	aliases, err := mailserverCache.getAliases(ctx, h.docker, container.ID, false)
 	if err != nil {
-		c.JSON(500, models.ErrorResponse{Error: err.Error()})
+		c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	if err := validateAliasChain(aliases.Aliases, newAlias, models.GetAliasMaxDepth()); err != nil {
+		c.JSON(400, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	err = addAlias(ctx, h.docker, container.ID, newAlias)
+	mailserverCache.invalidate(container.ID)
+	if err != nil {
+		c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	eventBroadcaster.publish(models.EventResponse{Type: eventAliasCreated, Alias: &newAlias})
 	c.JSON(201, newAlias)
 }
 
@@ -124,69 +258,92 @@ func AliasesPostHandler(c *gin.Context) {
 //	@Accept			json
 //	@Produce		json
 //	@Success		204
-//	@Failure		500		{object}	models.ErrorResponse
-//	@Failure		400		{object}	models.ErrorResponse
-//	@Failure		404		{object}	models.ErrorResponse
-//	@Param			alias	path		string	true	"Alias to delete"
+//	@Failure		500				{object}	models.ErrorResponse
+//	@Failure		503				{object}	models.ErrorResponse
+//	@Failure		504				{object}	models.ErrorResponse
+//	@Failure		400				{object}	models.ErrorResponse
+//	@Failure		404				{object}	models.ErrorResponse
+//	@Failure		412				{object}	models.ErrorResponse
+//	@Failure		422				{object}	models.ErrorResponse
+//	@Param			alias			path		string	true	"Alias to delete"
+//	@Param			If-Match		header		string	false	"ETag of the alias set from GET /v1/aliases, fails with 412 if the aliases were changed"
+//	@Param			Idempotency-Key	header		string	false	"Key to safely retry the request, the response is replayed for retries"
+//	@Failure		429				{object}	models.ErrorResponse
+//	@Failure		403				{object}	models.ErrorResponse
+//	@Failure		401				{object}	models.ErrorResponse
 //	@Router			/v1/aliases/{alias} [delete]
-func AliasesDeleteHandler(c *gin.Context) {
+func (h *Handler) AliasesDeleteHandler(c *gin.Context) {
 	alias := c.Param("alias")
 	if alias == "" {
 		c.JSON(400, models.ErrorResponse{Error: "Alias must be provided"})
 		return
 	}
+	if !checkDomainAllowed(c, alias) {
+		return
+	}
 
-	cli, err := getDockerClient()
+	ctx := c.Request.Context()
+	container, err := getMailserverContainer(ctx, h.docker)
 	if err != nil {
-		c.JSON(500, models.ErrorResponse{Error: err.Error()})
+		c.JSON(containerErrorStatus(err), models.ErrorResponse{Error: err.Error()})
 		return
 	}
-	defer cli.Close()
 
-	container, err := getMailserverContainer(cli)
+	unlock, err := mailserverLock.acquire(ctx, container.ID, models.GetLockTimeout())
 	if err != nil {
-		c.JSON(500, models.ErrorResponse{Error: err.Error()})
+		c.JSON(lockErrorStatus(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	defer unlock()
+
+	if !checkIfMatch(c, h.docker, container.ID) {
 		return
 	}
 
-	existingAlias, err := checkIfAliasExists(cli, container.ID, alias)
+	existingAlias, err := checkIfAliasExists(ctx, h.docker, container.ID, alias)
+	if errors.Is(err, errAliasNotFound) {
+		c.JSON(404, models.ErrorResponse{Error: err.Error()})
+		return
+	}
 	if err != nil {
-		c.JSON(500, models.ErrorResponse{Error: err.Error()})
+		c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	err = deleteAlias(cli, container.ID, existingAlias)
+	err = deleteAlias(ctx, h.docker, container.ID, existingAlias)
+	mailserverCache.invalidate(container.ID)
 	if err != nil {
-		c.JSON(500, models.ErrorResponse{Error: err.Error()})
+		c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	eventBroadcaster.publish(models.EventResponse{Type: eventAliasDeleted, Alias: &existingAlias})
 	c.Status(204)
 }
 
-func checkIfAliasExists(cli DockerClient, containerName string, alias string) (models.AliasResponse, error) {
-	aliases, err := getAliases(cli, containerName)
+func checkIfAliasExists(ctx context.Context, cli DockerClient, containerName string, alias string) (models.AliasResponse, error) {
+	aliases, err := mailserverCache.getAliases(ctx, cli, containerName, false)
 	if err != nil {
 		return models.AliasResponse{}, err
 	}
 
 	for _, a := range aliases.Aliases {
-		if a.Alias == alias {
+		if strings.EqualFold(a.Alias, alias) {
 			return a, nil
 		}
 	}
 
-	return models.AliasResponse{}, errors.New("alias not found")
+	return models.AliasResponse{}, errAliasNotFound
 }
 
-func checkIfEmailExists(cli DockerClient, containerName string, email string) (bool, error) {
-	emails, err := getEmails(cli, containerName)
+func checkIfEmailExists(ctx context.Context, cli DockerClient, containerName string, email string) (bool, error) {
+	emails, err := mailserverCache.getEmails(ctx, cli, containerName, false)
 	if err != nil {
 		return false, err
 	}
 
 	for _, e := range emails {
-		if e == email {
+		if strings.EqualFold(e, email) {
 			return true, nil
 		}
 	}
@@ -194,77 +351,38 @@ func checkIfEmailExists(cli DockerClient, containerName string, email string) (b
 	return false, nil
 }
 
-func deleteAlias(cli DockerClient, containerName string, alias models.AliasResponse) error {
-	ctx := context.Background()
-
-	execConfig := container.ExecOptions{
-		Cmd:          []string{"setup", "alias", "del", alias.Alias, alias.Email},
-		AttachStdout: true,
-		AttachStderr: true,
-	}
-
-	execId, err := cli.ContainerExecCreate(ctx, containerName, execConfig)
+// checkIfAliasIsMailbox reports whether the alias address is a mailbox,
+// ignoring case like Postfix does.
+func checkIfAliasIsMailbox(ctx context.Context, cli DockerClient, containerName string, alias string) (bool, error) {
+	emails, err := mailserverCache.getEmails(ctx, cli, containerName, false)
 	if err != nil {
-		return err
-	}
-
-	_, err = cli.ContainerExecAttach(ctx, execId.ID, container.ExecStartOptions{})
-	if err != nil {
-		return err
+		return false, err
 	}
 
-	return nil
+	return slices.ContainsFunc(emails, func(email string) bool {
+		return strings.EqualFold(email, alias)
+	}), nil
 }
 
-func addAlias(cli DockerClient, containerName string, alias models.AliasResponse) error {
-	ctx := context.Background()
-
-	execConfig := container.ExecOptions{
-		Cmd:          []string{"setup", "alias", "add", alias.Alias, alias.Email},
-		AttachStdout: true,
-		AttachStderr: true,
-	}
-
-	execId, err := cli.ContainerExecCreate(ctx, containerName, execConfig)
-	if err != nil {
-		return err
-	}
-
-	_, err = cli.ContainerExecAttach(ctx, execId.ID, container.ExecStartOptions{})
-	if err != nil {
-		return err
-	}
-
-	return nil
+func deleteAlias(ctx context.Context, cli DockerClient, containerName string, alias models.AliasResponse) error {
+	_, err := runSetupCommand(ctx, cli, containerName, "alias", "del", alias.Alias, alias.Email)
+	return err
 }
 
-func getAliases(cli DockerClient, containerName string) (models.AliasListResponse, error) {
-	ctx := context.Background()
-
-	execConfig := container.ExecOptions{
-		Cmd:          []string{"setup", "alias", "list"},
-		AttachStdout: true,
-		AttachStderr: true,
-	}
-
-	execId, err := cli.ContainerExecCreate(ctx, containerName, execConfig)
-	if err != nil {
-		return models.AliasListResponse{}, err
-	}
-
-	resp, err := cli.ContainerExecAttach(ctx, execId.ID, container.ExecStartOptions{})
-	if err != nil {
-		return models.AliasListResponse{}, err
-	}
-	defer resp.Close()
+func addAlias(ctx context.Context, cli DockerClient, containerName string, alias models.AliasResponse) error {
+	_, err := runSetupCommand(ctx, cli, containerName, "alias", "add", alias.Alias, alias.Email)
+	return err
+}
 
-	var outBuf, _ bytes.Buffer
-	_, err = io.Copy(&outBuf, resp.Reader)
+func getAliases(ctx context.Context, cli DockerClient, containerName string) (models.AliasListResponse, error) {
+	output, err := runSetupCommand(ctx, cli, containerName, "alias", "list")
 	if err != nil {
 		return models.AliasListResponse{}, err
 	}
 
-	return parseAliasCommandResult(outBuf.String()), nil
+	aliases := parseAliasCommandResult(output)
+	observeAliases(aliases.Aliases)
+	return aliases, nil
 }
 
 func parseAliasCommandResult(commandResult string) models.AliasListResponse {
@@ -3,6 +3,7 @@ package routes
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"io"
 	"net"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
 	"github.com/gin-gonic/gin"
 	"github.com/scheidti/docker-mailserver-aliases/models"
 	"github.com/stretchr/testify/assert"
@@ -67,8 +69,9 @@ func TestAliasGetHandler(t *testing.T) {
 * alias2@website.de admin@website.de`))),
 			Conn: mockHijackedResponseConn,
 		}, nil)
+		mockClient.On("ContainerExecInspect", mock.Anything, mock.Anything).Return(container.ExecInspect{ExitCode: 0}, nil)
 
-		aliases, err := getAliases(mockClient, "containerId")
+		aliases, err := getAliases(context.Background(), mockClient, "containerId")
 		assert.NoError(t, err)
 		assert.Equal(t, models.AliasListResponse{
 			Aliases: []models.AliasResponse{
@@ -82,7 +85,7 @@ func TestAliasGetHandler(t *testing.T) {
 		mockClient := new(MockDockerClient)
 		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{}, errors.New("exec create error"))
 
-		aliases, err := getAliases(mockClient, "containerId")
+		aliases, err := getAliases(context.Background(), mockClient, "containerId")
 		assert.Error(t, err)
 		assert.Empty(t, aliases.Aliases)
 	})
@@ -92,7 +95,7 @@ func TestAliasGetHandler(t *testing.T) {
 		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{ID: "execId"}, nil)
 		mockClient.On("ContainerExecAttach", mock.Anything, mock.Anything, mock.Anything).Return(types.HijackedResponse{}, errors.New("exec attach error"))
 
-		aliases, err := getAliases(mockClient, "containerId")
+		aliases, err := getAliases(context.Background(), mockClient, "containerId")
 		assert.Error(t, err)
 		assert.Empty(t, aliases.Aliases)
 	})
@@ -107,8 +110,9 @@ func TestAliasGetHandler(t *testing.T) {
 			Reader: bufio.NewReader(io.NopCloser(&errorReader{})),
 			Conn:   mockHijackedResponseConn,
 		}, nil)
+		mockClient.On("ContainerExecInspect", mock.Anything, mock.Anything).Return(container.ExecInspect{ExitCode: 0}, nil)
 
-		aliases, err := getAliases(mockClient, "containerId")
+		aliases, err := getAliases(context.Background(), mockClient, "containerId")
 		assert.Error(t, err)
 		assert.Empty(t, aliases.Aliases)
 	})
@@ -200,17 +204,47 @@ func TestAliasGetHandler(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("GET should list the aliases with the client of the handler", func(t *testing.T) {
+		mailserverCache.invalidateAll()
+		t.Cleanup(mailserverCache.invalidateAll)
+		t.Cleanup(mailserverWatcher.reset)
+
+		mockClient := newAliasListMock("* postmaster@website.de admin@website.de\n")
+		mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
+			{ID: "handlerId", Image: "mailserver/docker-mailserver"},
+		}, nil)
+
+		router := gin.New()
+		router.GET("/v1/aliases", NewHandler(mockClient).AliasesGetHandler)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/aliases", nil))
+
+		assert.Equal(t, 200, w.Code)
+		assert.JSONEq(t, `{"aliases": [{"alias": "postmaster@website.de", "email": "admin@website.de"}], "total": 1}`, w.Body.String())
+		mockClient.AssertCalled(t, "ContainerExecCreate", mock.Anything, "handlerId", mock.Anything)
+	})
 }
 
 func TestAliasPostHandler(t *testing.T) {
 	gin.SetMode(gin.TestMode)
+	mailserverCache.invalidateAll()
+	t.Cleanup(mailserverCache.invalidateAll)
 
 	t.Run("addAlias should add an alias", func(t *testing.T) {
+		mockHijackedResponseConn := new(MockHijackedResponseConn)
+		mockHijackedResponseConn.On("Close").Return(nil)
+
 		mockClient := new(MockDockerClient)
 		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{ID: "execId"}, nil)
-		mockClient.On("ContainerExecAttach", mock.Anything, mock.Anything, mock.Anything).Return(types.HijackedResponse{}, nil)
+		mockClient.On("ContainerExecAttach", mock.Anything, mock.Anything, mock.Anything).Return(types.HijackedResponse{
+			Reader: bufio.NewReader(bytes.NewBufferString("")),
+			Conn:   mockHijackedResponseConn,
+		}, nil)
+		mockClient.On("ContainerExecInspect", mock.Anything, mock.Anything).Return(container.ExecInspect{ExitCode: 0}, nil)
 
-		err := addAlias(mockClient, "containerId", models.AliasResponse{Alias: "test@alias.de", Email: "user@mail.de"})
+		err := addAlias(context.Background(), mockClient, "containerId", models.AliasResponse{Alias: "test@alias.de", Email: "user@mail.de"})
 		assert.NoError(t, err)
 	})
 
@@ -218,7 +252,7 @@ func TestAliasPostHandler(t *testing.T) {
 		mockClient := new(MockDockerClient)
 		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{}, errors.New("exec create error"))
 
-		err := addAlias(mockClient, "containerId", models.AliasResponse{Alias: "test@alias.de", Email: "user@mail.de"})
+		err := addAlias(context.Background(), mockClient, "containerId", models.AliasResponse{Alias: "test@alias.de", Email: "user@mail.de"})
 		assert.Error(t, err)
 	})
 
@@ -227,11 +261,11 @@ func TestAliasPostHandler(t *testing.T) {
 		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{ID: "execId"}, nil)
 		mockClient.On("ContainerExecAttach", mock.Anything, mock.Anything, mock.Anything).Return(types.HijackedResponse{}, errors.New("exec attach error"))
 
-		err := addAlias(mockClient, "containerId", models.AliasResponse{Alias: "test@alias.de", Email: "user@mail.de"})
+		err := addAlias(context.Background(), mockClient, "containerId", models.AliasResponse{Alias: "test@alias.de", Email: "user@mail.de"})
 		assert.Error(t, err)
 	})
 
-	t.Run("checkIfEmailExists should return true if email exists", func(t *testing.T) {
+	t.Run("checkIfEmailExists should return true if email exists ignoring case", func(t *testing.T) {
 		mockHijackedResponseConn := new(MockHijackedResponseConn)
 		mockHijackedResponseConn.On("Close").Return(nil)
 
@@ -241,8 +275,13 @@ func TestAliasPostHandler(t *testing.T) {
 			Reader: bufio.NewReader(io.NopCloser(bytes.NewBufferString(`* name@developer.de ( 969K / ~ ) [0%] [ aliases -> postmaster@mail.de ]`))),
 			Conn:   mockHijackedResponseConn,
 		}, nil)
+		mockClient.On("ContainerExecInspect", mock.Anything, mock.Anything).Return(container.ExecInspect{ExitCode: 0}, nil)
+
+		exists, err := checkIfEmailExists(context.Background(), mockClient, "containerId", "name@developer.de")
+		assert.NoError(t, err)
+		assert.True(t, exists)
 
-		exists, err := checkIfEmailExists(mockClient, "containerId", "name@developer.de")
+		exists, err = checkIfEmailExists(context.Background(), mockClient, "containerId", "Name@Developer.de")
 		assert.NoError(t, err)
 		assert.True(t, exists)
 	})
@@ -257,8 +296,9 @@ func TestAliasPostHandler(t *testing.T) {
 			Reader: bufio.NewReader(io.NopCloser(bytes.NewBufferString(`* name@developer.de ( 969K / ~ ) [0%] [ aliases -> postmaster@mail.de ]`))),
 			Conn:   mockHijackedResponseConn,
 		}, nil)
+		mockClient.On("ContainerExecInspect", mock.Anything, mock.Anything).Return(container.ExecInspect{ExitCode: 0}, nil)
 
-		exists, err := checkIfEmailExists(mockClient, "containerId", "doesNotExist@developer.de")
+		exists, err := checkIfEmailExists(context.Background(), mockClient, "containerId", "doesNotExist@developer.de")
 		assert.NoError(t, err)
 		assert.False(t, exists)
 	})
@@ -274,8 +314,9 @@ func TestAliasPostHandler(t *testing.T) {
 * alias2@website.de admin@website.de`))),
 			Conn: mockHijackedResponseConn,
 		}, nil)
+		mockClient.On("ContainerExecInspect", mock.Anything, mock.Anything).Return(container.ExecInspect{ExitCode: 0}, nil)
 
-		exists, err := checkIfAliasExists(mockClient, "containerId", "alias2@website.de")
+		exists, err := checkIfAliasExists(context.Background(), mockClient, "containerId", "alias2@website.de")
 		assert.NoError(t, err)
 		assert.Equal(t, models.AliasResponse{Alias: "alias2@website.de", Email: "admin@website.de"}, exists)
 	})
@@ -291,16 +332,84 @@ func TestAliasPostHandler(t *testing.T) {
 * alias2@website.de admin@website.de`))),
 			Conn: mockHijackedResponseConn,
 		}, nil)
+		mockClient.On("ContainerExecInspect", mock.Anything, mock.Anything).Return(container.ExecInspect{ExitCode: 0}, nil)
 
-		exists, err := checkIfAliasExists(mockClient, "containerId", "wrong@website.de")
-		assert.Error(t, err)
+		exists, err := checkIfAliasExists(context.Background(), mockClient, "containerId", "wrong@website.de")
+		assert.ErrorIs(t, err, errAliasNotFound)
 		assert.Empty(t, exists.Alias)
 	})
 
+	t.Run("checkIfAliasExists should ignore case", func(t *testing.T) {
+		mockClient := newAliasListMock("* alias2@website.de admin@website.de\n")
+
+		exists, err := checkIfAliasExists(context.Background(), mockClient, "containerId", "Alias2@Website.de")
+		assert.NoError(t, err)
+		assert.Equal(t, models.AliasResponse{Alias: "alias2@website.de", Email: "admin@website.de"}, exists)
+	})
+
+	t.Run("checkIfAliasIsMailbox should ignore case", func(t *testing.T) {
+		mockClient := new(MockDockerClient)
+		mockHijackedResponseConn := new(MockHijackedResponseConn)
+		mockHijackedResponseConn.On("Close").Return(nil)
+		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{ID: "execId"}, nil)
+		mockClient.On("ContainerExecAttach", mock.Anything, mock.Anything, mock.Anything).Return(types.HijackedResponse{
+			Reader: bufio.NewReader(io.NopCloser(bytes.NewBufferString(`* admin@website.de ( 969K / ~ ) [0%]`))),
+			Conn:   mockHijackedResponseConn,
+		}, nil)
+		mockClient.On("ContainerExecInspect", mock.Anything, mock.Anything).Return(container.ExecInspect{ExitCode: 0}, nil)
+
+		isMailbox, err := checkIfAliasIsMailbox(context.Background(), mockClient, "collisionId", "Admin@Website.de")
+		assert.NoError(t, err)
+		assert.True(t, isMailbox)
+
+		isMailbox, err = checkIfAliasIsMailbox(context.Background(), mockClient, "collisionId", "info@website.de")
+		assert.NoError(t, err)
+		assert.False(t, isMailbox)
+	})
+
+	t.Run("checkIfAliasIsMailbox should handle errors", func(t *testing.T) {
+		mockClient := new(MockDockerClient)
+		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{}, errors.New("exec create error"))
+
+		_, err := checkIfAliasIsMailbox(context.Background(), mockClient, "failingId", "admin@website.de")
+		assert.Error(t, err)
+	})
+
+	t.Run("POST of an existing alias should return it or 409 for another destination", func(t *testing.T) {
+		t.Cleanup(mailserverCache.invalidateAll)
+		t.Cleanup(mailserverWatcher.reset)
+
+		tests := []struct {
+			body         string
+			expectedCode int
+			expectedBody string
+		}{
+			{`{"alias": "postmaster@website.de", "email": "Admin@website.de"}`, 200, `{"alias": "postmaster@website.de", "email": "admin@website.de"}`},
+			{`{"alias": "postmaster@website.de", "email": "info@website.de"}`, 409, `{"error": "Alias already exists", "code": "alias_exists"}`},
+		}
+
+		for _, tt := range tests {
+			mockClient := newAliasListMock("* postmaster@website.de admin@website.de\n")
+			mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
+				{ID: "existingId", Image: "mailserver/docker-mailserver"},
+			}, nil)
+
+			router := gin.New()
+			router.POST("/v1/aliases", NewHandler(mockClient).AliasesPostHandler)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/aliases", bytes.NewBufferString(tt.body)))
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+			// Only the aliases were listed, nothing was added
+			mockClient.AssertNumberOfCalls(t, "ContainerExecCreate", 1)
+		}
+	})
+
 	t.Run("POST with invalid JSON should return 400", func(t *testing.T) {
 		router := gin.Default()
 		router.POST("/v1/aliases", func(c *gin.Context) {
-			AliasesPostHandler(c)
+			NewHandler(new(MockDockerClient)).AliasesPostHandler(c)
 		})
 
 		w := httptest.NewRecorder()
@@ -314,7 +423,7 @@ func TestAliasPostHandler(t *testing.T) {
 	t.Run("POST with invalid alias should return 400", func(t *testing.T) {
 		router := gin.Default()
 		router.POST("/v1/aliases", func(c *gin.Context) {
-			AliasesPostHandler(c)
+			NewHandler(new(MockDockerClient)).AliasesPostHandler(c)
 		})
 
 		w := httptest.NewRecorder()
@@ -330,11 +439,18 @@ func TestAliasDeleteHandler(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	t.Run("deleteAlias should delete an alias", func(t *testing.T) {
+		mockHijackedResponseConn := new(MockHijackedResponseConn)
+		mockHijackedResponseConn.On("Close").Return(nil)
+
 		mockClient := new(MockDockerClient)
 		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{ID: "execId"}, nil)
-		mockClient.On("ContainerExecAttach", mock.Anything, mock.Anything, mock.Anything).Return(types.HijackedResponse{}, nil)
+		mockClient.On("ContainerExecAttach", mock.Anything, mock.Anything, mock.Anything).Return(types.HijackedResponse{
+			Reader: bufio.NewReader(bytes.NewBufferString("")),
+			Conn:   mockHijackedResponseConn,
+		}, nil)
+		mockClient.On("ContainerExecInspect", mock.Anything, mock.Anything).Return(container.ExecInspect{ExitCode: 0}, nil)
 
-		err := deleteAlias(mockClient, "containerId", models.AliasResponse{Alias: "alias@mail.de", Email: "user@mail.de"})
+		err := deleteAlias(context.Background(), mockClient, "containerId", models.AliasResponse{Alias: "alias@mail.de", Email: "user@mail.de"})
 		assert.NoError(t, err)
 	})
 
@@ -342,7 +458,7 @@ func TestAliasDeleteHandler(t *testing.T) {
 		mockClient := new(MockDockerClient)
 		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{}, errors.New("exec create error"))
 
-		err := deleteAlias(mockClient, "containerId", models.AliasResponse{Alias: "alias@mail.de", Email: "user@mail.de"})
+		err := deleteAlias(context.Background(), mockClient, "containerId", models.AliasResponse{Alias: "alias@mail.de", Email: "user@mail.de"})
 		assert.Error(t, err)
 	})
 
@@ -351,8 +467,28 @@ func TestAliasDeleteHandler(t *testing.T) {
 		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{ID: "execId"}, nil)
 		mockClient.On("ContainerExecAttach", mock.Anything, mock.Anything, mock.Anything).Return(types.HijackedResponse{}, errors.New("exec attach error"))
 
-		err := deleteAlias(mockClient, "containerId", models.AliasResponse{Alias: "alias@mail.de", Email: "user@mail.de"})
+		err := deleteAlias(context.Background(), mockClient, "containerId", models.AliasResponse{Alias: "alias@mail.de", Email: "user@mail.de"})
 		assert.Error(t, err)
 	})
 
+	t.Run("DELETE of an unknown alias should return 404", func(t *testing.T) {
+		t.Cleanup(mailserverCache.invalidateAll)
+		t.Cleanup(mailserverWatcher.reset)
+
+		mockClient := newAliasListMock("* postmaster@website.de admin@website.de\n")
+		mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
+			{ID: "deleteId", Image: "mailserver/docker-mailserver"},
+		}, nil)
+
+		router := gin.New()
+		router.DELETE("/v1/aliases/:alias", NewHandler(mockClient).AliasesDeleteHandler)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("DELETE", "/v1/aliases/unknown@website.de", nil))
+
+		assert.Equal(t, 404, w.Code)
+		assert.JSONEq(t, `{"error": "Alias not found"}`, w.Body.String())
+		// Only the aliases were listed, nothing was deleted
+		mockClient.AssertNumberOfCalls(t, "ContainerExecCreate", 1)
+	})
 }
@@ -0,0 +1,130 @@
+package routes
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+)
+
+const (
+	errorCodeUnauthenticated         = "unauthenticated"
+	errorCodeUntrustedIdentityHeader = "untrusted_identity_header"
+)
+
+// actor is the user a request is made for. Requests with an API token are
+// made for the token, which is limited to its scopes and domains.
+type actor struct {
+	user    string
+	groups  []string
+	token   string
+	scopes  []string
+	domains []string
+}
+
+func (a actor) hasScope(scope string) bool {
+	return a.token == "" || slices.Contains(a.scopes, scope)
+}
+
+// limitedToDomains reports whether the actor is an API token limited to
+// some domains.
+func (a actor) limitedToDomains() bool {
+	return a.token != "" && len(a.domains) > 0
+}
+
+func (a actor) allowsDomain(domain string) bool {
+	return !a.limitedToDomains() || slices.ContainsFunc(a.domains, func(allowed string) bool {
+		return strings.EqualFold(allowed, domain)
+	})
+}
+
+type actorKey struct{}
+
+func withActor(ctx context.Context, a actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, a)
+}
+
+// actorFrom returns the user of the request, if it was authenticated.
+func actorFrom(ctx context.Context) (actor, bool) {
+	a, ok := ctx.Value(actorKey{}).(actor)
+	return a, ok
+}
+
+// ForwardAuthMiddleware authenticates requests by the user and group headers
+// of an authenticating reverse proxy like Authelia, if FORWARD_AUTH_PROXIES
+// is set. The headers are only trusted from these proxies, requests sending
+// them from other addresses are rejected with 403, as they try to bypass the
+// proxy. All other requests without a user are rejected with 401, unless
+// they were authenticated with an API token.
+func ForwardAuthMiddleware(c *gin.Context) {
+	proxies := models.GetForwardAuthProxies()
+	if _, ok := actorFrom(c.Request.Context()); ok {
+		c.Next()
+		return
+	}
+	if len(proxies) == 0 {
+		c.Next()
+		return
+	}
+
+	userHeader := models.GetForwardAuthUserHeader()
+	groupsHeader := models.GetForwardAuthGroupsHeader()
+	user := strings.TrimSpace(c.GetHeader(userHeader))
+
+	// The address of the connection, not the client IP taken from
+	// X-Forwarded-For, which can be set by anyone
+	if !fromForwardAuthProxy(c.RemoteIP(), proxies) {
+		if user != "" || c.GetHeader(groupsHeader) != "" {
+			logger(c.Request.Context()).Warn("Rejected identity header from untrusted address",
+				slog.String("remote_ip", c.RemoteIP()),
+				slog.String("header", userHeader),
+			)
+			rejectCredentials(c, 403, models.ErrorResponse{Error: "Identity headers are only accepted from the authenticating proxy", Code: errorCodeUntrustedIdentityHeader})
+			return
+		}
+		c.AbortWithStatusJSON(401, models.ErrorResponse{Error: "Authentication required", Code: errorCodeUnauthenticated})
+		return
+	}
+	if user == "" {
+		c.AbortWithStatusJSON(401, models.ErrorResponse{Error: "Authentication required", Code: errorCodeUnauthenticated})
+		return
+	}
+
+	a := actor{user: user, groups: splitGroups(c.GetHeader(groupsHeader))}
+	c.Request = c.Request.WithContext(withActor(c.Request.Context(), a))
+	c.Next()
+}
+
+func fromForwardAuthProxy(remoteIP string, proxies []string) bool {
+	addr, err := netip.ParseAddr(remoteIP)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, proxy := range proxies {
+		if prefix, err := netip.ParsePrefix(proxy); err == nil {
+			if prefix.Contains(addr) {
+				return true
+			}
+		} else if proxyAddr, err := netip.ParseAddr(proxy); err == nil && proxyAddr.Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// splitGroups splits the comma-separated groups sent by the proxy.
+func splitGroups(value string) []string {
+	var groups []string
+	for group := range strings.SplitSeq(value, ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwardAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(ForwardAuthMiddleware)
+	router.GET("/v1/status", func(c *gin.Context) {
+		a, ok := actorFrom(c.Request.Context())
+		if !ok {
+			c.String(200, "anonymous")
+			return
+		}
+		c.String(200, a.user+":"+strings.Join(a.groups, ","))
+	})
+
+	request := func(remoteAddr string, header map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/v1/status", nil)
+		req.RemoteAddr = remoteAddr
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("ForwardAuthMiddleware should ignore the headers without FORWARD_AUTH_PROXIES", func(t *testing.T) {
+		w := request("192.0.2.1:1234", map[string]string{"Remote-User": "admin"})
+
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, "anonymous", w.Body.String())
+	})
+
+	t.Run("ForwardAuthMiddleware should take the user and groups from the proxy", func(t *testing.T) {
+		t.Setenv("FORWARD_AUTH_PROXIES", "172.16.0.0/12,10.0.0.1")
+
+		w := request("172.18.0.5:1234", map[string]string{"Remote-User": "john", "Remote-Groups": "admins, dev,"})
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, "john:admins,dev", w.Body.String())
+
+		w = request("[::ffff:10.0.0.1]:1234", map[string]string{"Remote-User": "jane"})
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, "jane:", w.Body.String())
+	})
+
+	t.Run("ForwardAuthMiddleware should use the configured headers", func(t *testing.T) {
+		t.Setenv("FORWARD_AUTH_PROXIES", "10.0.0.1")
+		t.Setenv("FORWARD_AUTH_USER_HEADER", "X-Forwarded-User")
+		t.Setenv("FORWARD_AUTH_GROUPS_HEADER", "X-Forwarded-Groups")
+
+		w := request("10.0.0.1:1234", map[string]string{"X-Forwarded-User": "john", "Remote-Groups": "admins", "X-Forwarded-Groups": "dev"})
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, "john:dev", w.Body.String())
+	})
+
+	t.Run("ForwardAuthMiddleware should reject identity headers from other addresses", func(t *testing.T) {
+		t.Setenv("FORWARD_AUTH_PROXIES", "10.0.0.1")
+
+		w := request("192.0.2.1:1234", map[string]string{"Remote-User": "admin", "X-Forwarded-For": "10.0.0.1"})
+		assert.Equal(t, 403, w.Code)
+		assert.JSONEq(t, `{"error": "Identity headers are only accepted from the authenticating proxy", "code": "untrusted_identity_header"}`, w.Body.String())
+
+		w = request("192.0.2.1:1234", map[string]string{"Remote-Groups": "admins"})
+		assert.Equal(t, 403, w.Code)
+	})
+
+	t.Run("ForwardAuthMiddleware should require a user", func(t *testing.T) {
+		t.Setenv("FORWARD_AUTH_PROXIES", "10.0.0.1")
+
+		w := request("192.0.2.1:1234", nil)
+		assert.Equal(t, 401, w.Code)
+		assert.JSONEq(t, `{"error": "Authentication required", "code": "unauthenticated"}`, w.Body.String())
+
+		w = request("10.0.0.1:1234", map[string]string{"Remote-Groups": "admins"})
+		assert.Equal(t, 401, w.Code)
+	})
+}
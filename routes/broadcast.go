@@ -0,0 +1,153 @@
+package routes
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+)
+
+const (
+	eventAliasCreated     = "alias_created"
+	eventAliasDeleted     = "alias_deleted"
+	eventAliasesChanged   = "aliases_changed"
+	eventMailboxesChanged = "mailboxes_changed"
+	eventStatusChanged    = "status_changed"
+)
+
+const (
+	eventBufferSize        = 32
+	eventHeartbeatInterval = 15 * time.Second
+)
+
+// EventsGetHandler godoc
+//
+//	@Summary	Stream of live updates
+//	@Schemes
+//	@Description	Streams Server-Sent Events whenever aliases or mailboxes change or the Docker Mailserver container status changes. The event name is the type of the event, a comment is sent as heartbeat.
+//	@Tags			Utility
+//	@Produce		text/event-stream
+//	@Success		200	{object}	models.EventResponse
+//	@Failure		429	{object}	models.ErrorResponse
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Router			/v1/events [get]
+func EventsGetHandler(c *gin.Context) {
+	a, _ := actorFrom(c.Request.Context())
+	events, unsubscribe := eventBroadcaster.subscribe()
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	// The stream is open much longer than the write timeout of the server
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		logger(c.Request.Context()).Warn("failed to disable write deadline of event stream", slog.String("error", err.Error()))
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	// Send the headers right away, so that clients know the stream is open
+	c.Status(200)
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-events:
+			if !ok {
+				// The client was too slow and got dropped, it will reconnect
+				return false
+			}
+			// Tokens limited to domains do not learn about other aliases
+			if event.Alias == nil || a.allowsDomain(domainOf(event.Alias.Alias)) {
+				c.SSEvent(event.Type, event)
+			}
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": heartbeat\n\n")
+			return err == nil
+		}
+	})
+}
+
+// broadcaster distributes events to all connected clients. Every client has
+// its own buffer, clients that do not keep up are disconnected instead of
+// blocking the publisher.
+type broadcaster struct {
+	mu         sync.Mutex
+	bufferSize int
+	clients    map[chan models.EventResponse]struct{}
+	closed     bool
+}
+
+var eventBroadcaster = newBroadcaster(eventBufferSize)
+
+func newBroadcaster(bufferSize int) *broadcaster {
+	return &broadcaster{
+		bufferSize: bufferSize,
+		clients:    make(map[chan models.EventResponse]struct{}),
+	}
+}
+
+func (b *broadcaster) subscribe() (<-chan models.EventResponse, func()) {
+	client := make(chan models.EventResponse, b.bufferSize)
+
+	b.mu.Lock()
+	if b.closed {
+		close(client)
+	} else {
+		b.clients[client] = struct{}{}
+	}
+	b.mu.Unlock()
+
+	return client, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.clients[client]; ok {
+			delete(b.clients, client)
+			close(client)
+		}
+	}
+}
+
+func (b *broadcaster) publish(event models.EventResponse) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for client := range b.clients {
+		select {
+		case client <- event:
+		default:
+			delete(b.clients, client)
+			close(client)
+		}
+	}
+}
+
+// close disconnects all clients and rejects new ones.
+func (b *broadcaster) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for client := range b.clients {
+		delete(b.clients, client)
+		close(client)
+	}
+}
+
+// CloseEventStreams ends all event streams, so that the server can shut down
+// without waiting for the clients to disconnect.
+func CloseEventStreams() {
+	eventBroadcaster.close()
+}
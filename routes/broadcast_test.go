@@ -0,0 +1,101 @@
+package routes
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroadcaster(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("publish should send events to all clients", func(t *testing.T) {
+		b := newBroadcaster(1)
+		first, unsubscribeFirst := b.subscribe()
+		defer unsubscribeFirst()
+		second, unsubscribeSecond := b.subscribe()
+		defer unsubscribeSecond()
+
+		event := models.EventResponse{Type: eventAliasesChanged}
+		b.publish(event)
+
+		assert.Equal(t, event, <-first)
+		assert.Equal(t, event, <-second)
+	})
+
+	t.Run("publish should drop clients with a full buffer", func(t *testing.T) {
+		b := newBroadcaster(1)
+		client, unsubscribe := b.subscribe()
+
+		b.publish(models.EventResponse{Type: eventAliasesChanged})
+		b.publish(models.EventResponse{Type: eventMailboxesChanged})
+
+		assert.Equal(t, models.EventResponse{Type: eventAliasesChanged}, <-client)
+		_, ok := <-client
+		assert.False(t, ok, "the client should have been disconnected")
+		assert.NotPanics(t, unsubscribe)
+	})
+
+	t.Run("unsubscribe should remove the client", func(t *testing.T) {
+		b := newBroadcaster(1)
+		_, unsubscribe := b.subscribe()
+		unsubscribe()
+
+		assert.Empty(t, b.clients)
+	})
+
+	t.Run("close should disconnect all clients and reject new ones", func(t *testing.T) {
+		b := newBroadcaster(1)
+		client, unsubscribe := b.subscribe()
+		b.close()
+
+		_, ok := <-client
+		assert.False(t, ok)
+		assert.NotPanics(t, unsubscribe)
+
+		late, _ := b.subscribe()
+		_, ok = <-late
+		assert.False(t, ok)
+	})
+
+	t.Run("GET /v1/events should stream published events", func(t *testing.T) {
+		router := gin.Default()
+		router.GET("/v1/events", EventsGetHandler)
+		server := httptest.NewServer(router)
+		defer server.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/v1/events", nil)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		eventBroadcaster.publish(models.EventResponse{
+			Type:  eventAliasCreated,
+			Alias: &models.AliasResponse{Alias: "info@website.de", Email: "admin@website.de"},
+		})
+
+		reader := bufio.NewReader(resp.Body)
+		var lines []string
+		for len(lines) < 2 {
+			line, err := reader.ReadString('\n')
+			assert.NoError(t, err)
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+
+		assert.Equal(t, "event:alias_created", lines[0])
+		assert.JSONEq(t, `{"type":"alias_created","alias":{"alias":"info@website.de","email":"admin@website.de"}}`, strings.TrimPrefix(lines[1], "data:"))
+	})
+}
@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/scheidti/docker-mailserver-aliases/models"
+)
+
+// listCache keeps the results of `setup alias list` and `setup email list`
+// per container for a limited time, so that handlers do not have to spawn
+// a new exec for every request. A TTL of zero disables caching.
+//
+// Every invalidation increments the generation of the container, lists that
+// were read before are not stored anymore, as they might miss the change.
+type listCache struct {
+	mu          sync.Mutex
+	ttl         time.Duration
+	now         func() time.Time
+	aliases     map[string]cacheEntry[[]models.AliasResponse]
+	emails      map[string]cacheEntry[[]string]
+	generations map[string]uint64
+	epoch       uint64
+}
+
+type cacheEntry[T any] struct {
+	value   T
+	expires time.Time
+}
+
+var mailserverCache = newListCache(models.GetCacheTTL())
+
+func newListCache(ttl time.Duration) *listCache {
+	return &listCache{
+		ttl:         ttl,
+		now:         time.Now,
+		aliases:     make(map[string]cacheEntry[[]models.AliasResponse]),
+		emails:      make(map[string]cacheEntry[[]string]),
+		generations: make(map[string]uint64),
+	}
+}
+
+func (c *listCache) getAliases(ctx context.Context, cli DockerClient, containerName string, fresh bool) (models.AliasListResponse, error) {
+	if !fresh {
+		if aliases, ok := lookup(c, c.aliases, containerName); ok {
+			return models.AliasListResponse{Aliases: aliases}, nil
+		}
+	}
+
+	generation := c.generation(containerName)
+	aliases, err := getAliases(ctx, cli, containerName)
+	if err != nil {
+		return models.AliasListResponse{}, err
+	}
+
+	store(c, c.aliases, containerName, generation, aliases.Aliases)
+	return models.AliasListResponse{Aliases: append([]models.AliasResponse{}, aliases.Aliases...)}, nil
+}
+
+func (c *listCache) getEmails(ctx context.Context, cli DockerClient, containerName string, fresh bool) ([]string, error) {
+	if !fresh {
+		if emails, ok := lookup(c, c.emails, containerName); ok {
+			return emails, nil
+		}
+	}
+
+	generation := c.generation(containerName)
+	emails, err := getEmails(ctx, cli, containerName)
+	if err != nil {
+		return nil, err
+	}
+
+	store(c, c.emails, containerName, generation, emails)
+	return append([]string{}, emails...), nil
+}
+
+// setTTL changes the TTL of lists cached from now on.
+func (c *listCache) setTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ttl = ttl
+}
+
+// invalidate drops all cached lists of the given container.
+func (c *listCache) invalidate(containerName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.aliases, containerName)
+	delete(c.emails, containerName)
+	c.generations[containerName]++
+}
+
+// invalidateAll drops the cached lists of every container.
+func (c *listCache) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.aliases)
+	clear(c.emails)
+	c.epoch++
+}
+
+// generation returns the current generation of the container, which changes
+// with every invalidation of it or of all containers.
+func (c *listCache) generation(containerName string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.epoch + c.generations[containerName]
+}
+
+func lookup[T any](c *listCache, entries map[string]cacheEntry[[]T], containerName string) ([]T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := entries[containerName]
+	if !ok || !c.now().Before(entry.expires) {
+		return nil, false
+	}
+
+	// Callers are free to modify the returned slice
+	return append([]T{}, entry.value...), true
+}
+
+func store[T any](c *listCache, entries map[string]cacheEntry[[]T], containerName string, generation uint64, value []T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The list was invalidated while it was read
+	if c.ttl <= 0 || c.epoch+c.generations[containerName] != generation {
+		return
+	}
+
+	entries[containerName] = cacheEntry[[]T]{
+		value:   append([]T{}, value...),
+		expires: c.now().Add(c.ttl),
+	}
+}
@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newAliasListMock(output string) *MockDockerClient {
+	mockHijackedResponseConn := new(MockHijackedResponseConn)
+	mockHijackedResponseConn.On("Close").Return(nil)
+
+	mockClient := new(MockDockerClient)
+	mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{ID: "execId"}, nil)
+	mockClient.On("ContainerExecAttach", mock.Anything, mock.Anything, mock.Anything).Return(types.HijackedResponse{
+		Reader: bufio.NewReader(bytes.NewBufferString(output)),
+		Conn:   mockHijackedResponseConn,
+	}, nil)
+	mockClient.On("ContainerExecInspect", mock.Anything, mock.Anything).Return(container.ExecInspect{ExitCode: 0}, nil)
+	return mockClient
+}
+
+func TestListCache(t *testing.T) {
+	t.Run("getAliases should only run one exec within the TTL", func(t *testing.T) {
+		cache := newListCache(time.Minute)
+		mockClient := newAliasListMock("* postmaster@website.de admin@website.de")
+
+		first, err := cache.getAliases(context.Background(), mockClient, "containerId", false)
+		assert.NoError(t, err)
+		second, err := cache.getAliases(context.Background(), mockClient, "containerId", false)
+		assert.NoError(t, err)
+
+		assert.Equal(t, first, second)
+		assert.Equal(t, []models.AliasResponse{{Alias: "postmaster@website.de", Email: "admin@website.de"}}, second.Aliases)
+		mockClient.AssertNumberOfCalls(t, "ContainerExecCreate", 1)
+	})
+
+	t.Run("getAliases should bypass the cache when fresh is requested", func(t *testing.T) {
+		cache := newListCache(time.Minute)
+		mockClient := newAliasListMock("")
+
+		_, err := cache.getAliases(context.Background(), mockClient, "containerId", false)
+		assert.NoError(t, err)
+		_, err = cache.getAliases(context.Background(), mockClient, "containerId", true)
+		assert.NoError(t, err)
+
+		mockClient.AssertNumberOfCalls(t, "ContainerExecCreate", 2)
+	})
+
+	t.Run("getAliases should run a new exec after the TTL expired", func(t *testing.T) {
+		now := time.Now()
+		cache := newListCache(time.Minute)
+		cache.now = func() time.Time { return now }
+		mockClient := newAliasListMock("")
+
+		_, err := cache.getAliases(context.Background(), mockClient, "containerId", false)
+		assert.NoError(t, err)
+		now = now.Add(2 * time.Minute)
+		_, err = cache.getAliases(context.Background(), mockClient, "containerId", false)
+		assert.NoError(t, err)
+
+		mockClient.AssertNumberOfCalls(t, "ContainerExecCreate", 2)
+	})
+
+	t.Run("invalidate should drop the cached lists of a container", func(t *testing.T) {
+		cache := newListCache(time.Minute)
+		mockClient := newAliasListMock("")
+
+		_, err := cache.getEmails(context.Background(), mockClient, "containerId", false)
+		assert.NoError(t, err)
+		cache.invalidate("containerId")
+		_, err = cache.getEmails(context.Background(), mockClient, "containerId", false)
+		assert.NoError(t, err)
+
+		mockClient.AssertNumberOfCalls(t, "ContainerExecCreate", 2)
+	})
+
+	t.Run("lists read while the container was invalidated should not be cached", func(t *testing.T) {
+		for name, invalidate := range map[string]func(*listCache){
+			"invalidate":    func(c *listCache) { c.invalidate("containerId") },
+			"invalidateAll": func(c *listCache) { c.invalidateAll() },
+		} {
+			t.Run(name, func(t *testing.T) {
+				cache := newListCache(time.Minute)
+				mockClient := newAliasListMock("")
+				mockClient.ExpectedCalls[0].Run(func(mock.Arguments) { invalidate(cache) })
+
+				_, err := cache.getAliases(context.Background(), mockClient, "containerId", false)
+				assert.NoError(t, err)
+				assert.NotContains(t, cache.aliases, "containerId")
+			})
+		}
+	})
+
+	t.Run("a TTL of zero should disable caching", func(t *testing.T) {
+		cache := newListCache(0)
+		mockClient := newAliasListMock("")
+
+		_, err := cache.getAliases(context.Background(), mockClient, "containerId", false)
+		assert.NoError(t, err)
+		_, err = cache.getAliases(context.Background(), mockClient, "containerId", false)
+		assert.NoError(t, err)
+
+		mockClient.AssertNumberOfCalls(t, "ContainerExecCreate", 2)
+	})
+
+	t.Run("errors should not be cached", func(t *testing.T) {
+		cache := newListCache(time.Minute)
+		mockClient := new(MockDockerClient)
+		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{}, errors.New("exec create error"))
+
+		_, err := cache.getAliases(context.Background(), mockClient, "containerId", false)
+		assert.Error(t, err)
+		_, err = cache.getAliases(context.Background(), mockClient, "containerId", false)
+		assert.Error(t, err)
+
+		mockClient.AssertNumberOfCalls(t, "ContainerExecCreate", 2)
+	})
+
+	t.Run("modifying a returned list should not modify the cache", func(t *testing.T) {
+		cache := newListCache(time.Minute)
+		mockClient := newAliasListMock("* postmaster@website.de admin@website.de")
+
+		first, err := cache.getAliases(context.Background(), mockClient, "containerId", false)
+		assert.NoError(t, err)
+		first.Aliases[0].Email = "changed@website.de"
+
+		second, err := cache.getAliases(context.Background(), mockClient, "containerId", false)
+		assert.NoError(t, err)
+		assert.Equal(t, "admin@website.de", second.Aliases[0].Email)
+	})
+}
@@ -0,0 +1,155 @@
+package routes
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/scheidti/docker-mailserver-aliases/models"
+)
+
+var (
+	errAliasLoop    = errors.New("Alias would create a loop")
+	errAliasTooDeep = errors.New("Alias chain would be too deep")
+)
+
+// aliasesReaching returns all aliases that forward to the mailbox, either
+// directly or through other aliases. Every alias comes with the shortest path
+// from the alias to the mailbox.
+func aliasesReaching(aliases []models.AliasResponse, mailbox string) []models.AliasPathResponse {
+	byDestination := make(map[string][]models.AliasResponse)
+	for _, alias := range aliases {
+		destination := strings.ToLower(alias.Email)
+		byDestination[destination] = append(byDestination[destination], alias)
+	}
+
+	result := make([]models.AliasPathResponse, 0)
+	visited := map[string]bool{strings.ToLower(mailbox): true}
+	queue := []models.AliasPathResponse{{Path: []string{mailbox}}}
+
+	// Walk the chains backwards from the mailbox. Visited addresses are
+	// skipped, which also stops at alias loops.
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, alias := range byDestination[strings.ToLower(current.Path[0])] {
+			key := strings.ToLower(alias.Alias)
+			if visited[key] {
+				continue
+			}
+			visited[key] = true
+
+			next := models.AliasPathResponse{
+				Alias: alias.Alias,
+				Path:  append([]string{alias.Alias}, current.Path...),
+			}
+			result = append(result, next)
+			queue = append(queue, next)
+		}
+	}
+
+	slices.SortStableFunc(result, func(a, b models.AliasPathResponse) int {
+		return cmp.Or(cmp.Compare(len(a.Path), len(b.Path)), compareFold(a.Alias, b.Alias))
+	})
+	return result
+}
+
+// validateAliasChain checks that adding the alias to the existing aliases
+// creates neither a loop nor a chain of more than maxDepth aliases.
+func validateAliasChain(aliases []models.AliasResponse, newAlias models.AliasResponse, maxDepth int) error {
+	graph := make(map[string]models.AliasResponse, len(aliases)+1)
+	others := make([]models.AliasResponse, 0, len(aliases))
+	for _, alias := range aliases {
+		if strings.EqualFold(alias.Alias, newAlias.Alias) {
+			continue
+		}
+		graph[strings.ToLower(alias.Alias)] = alias
+		others = append(others, alias)
+	}
+	graph[strings.ToLower(newAlias.Alias)] = newAlias
+
+	// Follow the chain from the new alias to its final destination
+	chain := []string{newAlias.Alias}
+	visited := map[string]bool{strings.ToLower(newAlias.Alias): true}
+	for address := newAlias.Email; ; {
+		chain = append(chain, address)
+		if visited[strings.ToLower(address)] {
+			return fmt.Errorf("%w: %s", errAliasLoop, strings.Join(chain, " -> "))
+		}
+		visited[strings.ToLower(address)] = true
+
+		next, ok := graph[strings.ToLower(address)]
+		if !ok {
+			break
+		}
+		address = next.Email
+	}
+
+	// Prepend the longest chain of aliases forwarding to the new alias, the
+	// paths are sorted by length
+	if upstream := aliasesReaching(others, newAlias.Alias); len(upstream) > 0 {
+		path := upstream[len(upstream)-1].Path
+		chain = append(slices.Clone(path[:len(path)-1]), chain...)
+	}
+
+	if depth := len(chain) - 1; depth > maxDepth {
+		return fmt.Errorf("%w, %d aliases exceed the maximum of %d: %s", errAliasTooDeep, depth, maxDepth, strings.Join(chain, " -> "))
+	}
+	return nil
+}
+
+// findAliasCycles returns all loops of the aliases, each starting and ending
+// with the alphabetically first alias of the loop.
+func findAliasCycles(aliases []models.AliasResponse) [][]string {
+	graph := make(map[string]models.AliasResponse, len(aliases))
+	for _, alias := range aliases {
+		graph[strings.ToLower(alias.Alias)] = alias
+	}
+
+	cycles := make([][]string, 0)
+	done := make(map[string]bool, len(graph))
+	for _, start := range aliases {
+		var walk []string
+		position := make(map[string]int)
+
+		for address := start.Alias; ; {
+			key := strings.ToLower(address)
+			alias, ok := graph[key]
+			if !ok || done[key] {
+				break
+			}
+			if i, ok := position[key]; ok {
+				cycles = append(cycles, rotateCycle(walk[i:]))
+				break
+			}
+			position[key] = len(walk)
+			walk = append(walk, alias.Alias)
+			address = alias.Email
+		}
+
+		for _, address := range walk {
+			done[strings.ToLower(address)] = true
+		}
+	}
+
+	slices.SortFunc(cycles, func(a, b []string) int {
+		return compareFold(a[0], b[0])
+	})
+	return cycles
+}
+
+// rotateCycle starts the loop with its alphabetically first alias and closes
+// it by repeating that alias at the end.
+func rotateCycle(cycle []string) []string {
+	first := 0
+	for i := range cycle {
+		if compareFold(cycle[i], cycle[first]) < 0 {
+			first = i
+		}
+	}
+	result := append(slices.Clone(cycle[first:]), cycle[:first]...)
+	return append(result, result[0])
+}
@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/scheidti/docker-mailserver-aliases/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAliasChains(t *testing.T) {
+	t.Run("aliasesReaching should return direct and transitive aliases with their path", func(t *testing.T) {
+		aliases := []models.AliasResponse{
+			{Alias: "postmaster@website.de", Email: "admin@website.de"},
+			{Alias: "webmaster@website.de", Email: "postmaster@website.de"},
+			{Alias: "hostmaster@website.de", Email: "Webmaster@website.de"},
+			{Alias: "info@website.de", Email: "team@website.de"},
+			{Alias: "abuse@website.de", Email: "admin@website.de"},
+		}
+
+		assert.Equal(t, []models.AliasPathResponse{
+			{Alias: "abuse@website.de", Path: []string{"abuse@website.de", "admin@website.de"}},
+			{Alias: "postmaster@website.de", Path: []string{"postmaster@website.de", "admin@website.de"}},
+			{Alias: "webmaster@website.de", Path: []string{"webmaster@website.de", "postmaster@website.de", "admin@website.de"}},
+			{Alias: "hostmaster@website.de", Path: []string{"hostmaster@website.de", "webmaster@website.de", "postmaster@website.de", "admin@website.de"}},
+		}, aliasesReaching(aliases, "admin@website.de"))
+	})
+
+	t.Run("aliasesReaching should stop at alias loops", func(t *testing.T) {
+		aliases := []models.AliasResponse{
+			{Alias: "a@website.de", Email: "admin@website.de"},
+			{Alias: "b@website.de", Email: "a@website.de"},
+			{Alias: "a@website.de", Email: "b@website.de"},
+		}
+
+		assert.Equal(t, []models.AliasPathResponse{
+			{Alias: "a@website.de", Path: []string{"a@website.de", "admin@website.de"}},
+			{Alias: "b@website.de", Path: []string{"b@website.de", "a@website.de", "admin@website.de"}},
+		}, aliasesReaching(aliases, "admin@website.de"))
+	})
+
+	t.Run("aliasesReaching should return an empty list without aliases", func(t *testing.T) {
+		assert.Equal(t, []models.AliasPathResponse{}, aliasesReaching(nil, "admin@website.de"))
+	})
+
+	t.Run("validateAliasChain should accept chains within the depth limit", func(t *testing.T) {
+		aliases := []models.AliasResponse{
+			{Alias: "postmaster@website.de", Email: "admin@website.de"},
+		}
+
+		err := validateAliasChain(aliases, models.AliasResponse{Alias: "webmaster@website.de", Email: "postmaster@website.de"}, 2)
+		assert.NoError(t, err)
+	})
+
+	t.Run("validateAliasChain should reject loops", func(t *testing.T) {
+		aliases := []models.AliasResponse{
+			{Alias: "b@website.de", Email: "c@website.de"},
+			{Alias: "c@website.de", Email: "A@website.de"},
+		}
+
+		err := validateAliasChain(aliases, models.AliasResponse{Alias: "a@website.de", Email: "b@website.de"}, 10)
+		assert.True(t, errors.Is(err, errAliasLoop))
+		assert.EqualError(t, err, "Alias would create a loop: a@website.de -> b@website.de -> c@website.de -> A@website.de")
+
+		err = validateAliasChain(nil, models.AliasResponse{Alias: "a@website.de", Email: "a@website.de"}, 10)
+		assert.True(t, errors.Is(err, errAliasLoop))
+	})
+
+	t.Run("validateAliasChain should reject existing loops behind the alias", func(t *testing.T) {
+		aliases := []models.AliasResponse{
+			{Alias: "b@website.de", Email: "c@website.de"},
+			{Alias: "c@website.de", Email: "b@website.de"},
+		}
+
+		err := validateAliasChain(aliases, models.AliasResponse{Alias: "a@website.de", Email: "b@website.de"}, 10)
+		assert.EqualError(t, err, "Alias would create a loop: a@website.de -> b@website.de -> c@website.de -> b@website.de")
+	})
+
+	t.Run("validateAliasChain should count aliases before and after the new alias", func(t *testing.T) {
+		aliases := []models.AliasResponse{
+			{Alias: "a@website.de", Email: "b@website.de"},
+			{Alias: "c@website.de", Email: "admin@website.de"},
+		}
+
+		err := validateAliasChain(aliases, models.AliasResponse{Alias: "b@website.de", Email: "c@website.de"}, 2)
+		assert.True(t, errors.Is(err, errAliasTooDeep))
+		assert.EqualError(t, err, "Alias chain would be too deep, 3 aliases exceed the maximum of 2: a@website.de -> b@website.de -> c@website.de -> admin@website.de")
+	})
+
+	t.Run("findAliasCycles should return every loop once", func(t *testing.T) {
+		aliases := []models.AliasResponse{
+			{Alias: "postmaster@website.de", Email: "admin@website.de"},
+			{Alias: "c@website.de", Email: "a@website.de"},
+			{Alias: "a@website.de", Email: "b@website.de"},
+			{Alias: "b@website.de", Email: "c@website.de"},
+			{Alias: "x@website.de", Email: "b@website.de"},
+			{Alias: "self@website.de", Email: "self@website.de"},
+		}
+
+		assert.Equal(t, [][]string{
+			{"a@website.de", "b@website.de", "c@website.de", "a@website.de"},
+			{"self@website.de", "self@website.de"},
+		}, findAliasCycles(aliases))
+	})
+
+	t.Run("findAliasCycles should return an empty list without loops", func(t *testing.T) {
+		aliases := []models.AliasResponse{
+			{Alias: "postmaster@website.de", Email: "admin@website.de"},
+		}
+
+		assert.Equal(t, [][]string{}, findAliasCycles(aliases))
+	})
+}
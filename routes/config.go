@@ -0,0 +1,12 @@
+package routes
+
+import "github.com/scheidti/docker-mailserver-aliases/models"
+
+// ApplyConfig updates the state created from the configuration before it was
+// loaded, and again after it was reloaded. All other settings are read from
+// the configuration whenever they are used.
+func ApplyConfig() {
+	mailserverCache.setTTL(models.GetCacheTTL())
+	idempotencyKeys.setTTL(models.GetIdempotencyTTL())
+	mailserverLock.setFile(models.GetLockFile())
+}
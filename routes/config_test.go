@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyConfig(t *testing.T) {
+	t.Run("ApplyConfig should update the cache, idempotency store and lock", func(t *testing.T) {
+		t.Cleanup(ApplyConfig)
+		t.Setenv("CACHE_TTL", "1m")
+		t.Setenv("IDEMPOTENCY_TTL", "2h")
+		t.Setenv("LOCK_FILE", "/tmp/aliases.lock")
+
+		ApplyConfig()
+		assert.Equal(t, time.Minute, mailserverCache.ttl)
+		assert.Equal(t, 2*time.Hour, idempotencyKeys.ttl)
+		assert.Equal(t, "/tmp/aliases.lock", mailserverLock.file)
+	})
+}
@@ -0,0 +1,180 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+)
+
+var (
+	errMailserverNotFound   = errors.New("mailserver container not found")
+	errMailserverNotRunning = errors.New("mailserver container is not running")
+)
+
+// mailserverState is the last known state of the mailserver container.
+type mailserverState struct {
+	ID     string
+	Name   string
+	Image  string
+	State  string
+	Health string
+}
+
+func (s mailserverState) running() bool {
+	return s.State == "running"
+}
+
+// containerWatcher keeps track of the mailserver container based on the
+// Docker events stream. Its view is only used while the stream is connected,
+// otherwise callers fall back to listing the containers.
+type containerWatcher struct {
+	mu         sync.RWMutex
+	synced     bool
+	found      bool
+	state      mailserverState
+	lastStatus models.StatusResponse
+}
+
+var mailserverWatcher = &containerWatcher{}
+
+// current returns the known mailserver container state. The second return
+// value is false if the watcher has no up-to-date view.
+func (w *containerWatcher) current() (mailserverState, bool, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if !w.synced {
+		return mailserverState{}, false, nil
+	}
+	if !w.found {
+		return mailserverState{}, true, errMailserverNotFound
+	}
+	return w.state, true, nil
+}
+
+// sync reads the mailserver container state from the Docker daemon.
+func (w *containerWatcher) sync(ctx context.Context, cli DockerClient) error {
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		w.reset()
+		return err
+	}
+
+	var found *types.Container
+	for i, c := range containers {
+		if !strings.Contains(c.Image, models.GetDockerImage()) {
+			continue
+		}
+		if found == nil || (c.State == "running" && found.State != "running") {
+			found = &containers[i]
+		}
+	}
+
+	if found == nil {
+		w.set(false, mailserverState{})
+		return nil
+	}
+
+	state := mailserverState{
+		ID:    found.ID,
+		Image: found.Image,
+		State: string(found.State),
+	}
+	if len(found.Names) > 0 {
+		state.Name = strings.TrimPrefix(found.Names[0], "/")
+	}
+
+	inspect, err := cli.ContainerInspect(ctx, found.ID)
+	if err != nil {
+		w.reset()
+		return err
+	}
+	if inspect.ContainerJSONBase != nil && inspect.State != nil {
+		state.State = string(inspect.State.Status)
+		if inspect.State.Health != nil {
+			state.Health = string(inspect.State.Health.Status)
+		}
+	}
+
+	w.set(true, state)
+	return nil
+}
+
+// reset marks the view as outdated, e.g. after the events stream failed.
+func (w *containerWatcher) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.synced = false
+}
+
+func (w *containerWatcher) set(found bool, state mailserverState) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.synced = true
+	w.found = found
+	w.state = state
+	w.notify()
+}
+
+// notify publishes a status event if running state or health changed.
+// The caller must hold the lock.
+func (w *containerWatcher) notify() {
+	status := models.StatusResponse{Running: w.found && w.state.running(), Health: w.state.Health}
+	if status == w.lastStatus {
+		return
+	}
+
+	w.lastStatus = status
+	setMailserverUp(status.Running)
+	eventBroadcaster.publish(models.EventResponse{Type: eventStatusChanged, Status: &status})
+}
+
+// apply updates the view with a container event of the mailserver image.
+// It returns true if the event requires a full sync, e.g. because a new
+// container was started.
+func (w *containerWatcher) apply(message events.Message) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.synced {
+		return false
+	}
+
+	switch message.Action {
+	case events.ActionStart, events.ActionRestart, events.ActionUnPause:
+		return true
+	}
+
+	if !w.found || w.state.ID != message.Actor.ID {
+		return false
+	}
+
+	// Kill is not handled, as it is also sent for signals the container
+	// survives, a fatal one is followed by die
+	switch message.Action {
+	case events.ActionStop, events.ActionDie:
+		w.state.State = "exited"
+		w.state.Health = ""
+	case events.ActionPause:
+		w.state.State = "paused"
+	case events.ActionDestroy:
+		w.found = false
+		w.state = mailserverState{}
+	default:
+		health, ok := strings.CutPrefix(string(message.Action), string(events.ActionHealthStatus)+":")
+		if ok {
+			w.state.Health = strings.TrimSpace(health)
+		}
+	}
+
+	w.notify()
+	return false
+}
@@ -0,0 +1,160 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newSyncedWatcher(t *testing.T, state mailserverState) {
+	mailserverWatcher.set(true, state)
+	t.Cleanup(mailserverWatcher.reset)
+}
+
+func TestContainerWatcher(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("sync should read state and health of the mailserver container", func(t *testing.T) {
+		watcher := &containerWatcher{}
+		mockClient := new(MockDockerClient)
+		mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
+			{ID: "otherId", Image: "test/some-other-image", State: "running"},
+			{ID: "oldId", Image: "mailserver/docker-mailserver", State: "exited"},
+			{ID: "containerId", Image: "mailserver/docker-mailserver", State: "running", Names: []string{"/mailserver"}},
+		}, nil)
+		mockClient.On("ContainerInspect", mock.Anything, "containerId").Return(container.InspectResponse{
+			ContainerJSONBase: &container.ContainerJSONBase{
+				State: &container.State{Status: "running", Health: &container.Health{Status: "healthy"}},
+			},
+		}, nil)
+
+		err := watcher.sync(context.Background(), mockClient)
+		assert.NoError(t, err)
+
+		state, synced, err := watcher.current()
+		assert.True(t, synced)
+		assert.NoError(t, err)
+		assert.Equal(t, mailserverState{
+			ID:     "containerId",
+			Name:   "mailserver",
+			Image:  "mailserver/docker-mailserver",
+			State:  "running",
+			Health: "healthy",
+		}, state)
+	})
+
+	t.Run("sync should report a missing mailserver container", func(t *testing.T) {
+		watcher := &containerWatcher{}
+		mockClient := new(MockDockerClient)
+		mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
+			{ID: "otherId", Image: "test/some-other-image", State: "running"},
+		}, nil)
+
+		err := watcher.sync(context.Background(), mockClient)
+		assert.NoError(t, err)
+
+		_, synced, err := watcher.current()
+		assert.True(t, synced)
+		assert.ErrorIs(t, err, errMailserverNotFound)
+	})
+
+	t.Run("sync should mark the view as outdated on errors", func(t *testing.T) {
+		watcher := &containerWatcher{}
+		watcher.set(true, mailserverState{ID: "containerId", State: "running"})
+		mockClient := new(MockDockerClient)
+		mockClient.On("ContainerList", mock.Anything, mock.Anything).Return(nil, errors.New("docker error"))
+
+		err := watcher.sync(context.Background(), mockClient)
+		assert.Error(t, err)
+
+		_, synced, _ := watcher.current()
+		assert.False(t, synced)
+	})
+
+	t.Run("apply should track lifecycle and health events", func(t *testing.T) {
+		watcher := &containerWatcher{}
+		watcher.set(true, mailserverState{ID: "containerId", State: "running", Health: "starting"})
+
+		assert.False(t, watcher.apply(events.Message{Action: "health_status: healthy", Actor: events.Actor{ID: "containerId"}}))
+		state, _, _ := watcher.current()
+		assert.Equal(t, "healthy", state.Health)
+
+		assert.False(t, watcher.apply(events.Message{Action: events.ActionDie, Actor: events.Actor{ID: "containerId"}}))
+		state, _, _ = watcher.current()
+		assert.Equal(t, "exited", state.State)
+		assert.False(t, state.running())
+
+		assert.True(t, watcher.apply(events.Message{Action: events.ActionStart, Actor: events.Actor{ID: "newId"}}))
+
+		assert.False(t, watcher.apply(events.Message{Action: events.ActionDestroy, Actor: events.Actor{ID: "containerId"}}))
+		_, _, err := watcher.current()
+		assert.ErrorIs(t, err, errMailserverNotFound)
+	})
+
+	t.Run("apply should keep the container running after a kill event", func(t *testing.T) {
+		watcher := &containerWatcher{}
+		watcher.set(true, mailserverState{ID: "containerId", State: "running"})
+
+		// docker kill -s HUP
+		watcher.apply(events.Message{Action: events.ActionKill, Actor: events.Actor{ID: "containerId", Attributes: map[string]string{"signal": "1"}}})
+		state, _, _ := watcher.current()
+		assert.True(t, state.running())
+	})
+
+	t.Run("apply should ignore events of other containers", func(t *testing.T) {
+		watcher := &containerWatcher{}
+		watcher.set(true, mailserverState{ID: "containerId", State: "running"})
+
+		watcher.apply(events.Message{Action: events.ActionDie, Actor: events.Actor{ID: "oldId"}})
+		state, _, _ := watcher.current()
+		assert.True(t, state.running())
+	})
+
+	t.Run("getMailserverContainer should fail fast if the watched container is stopped", func(t *testing.T) {
+		newSyncedWatcher(t, mailserverState{ID: "containerId", Image: "mailserver/docker-mailserver", State: "exited"})
+		mockClient := new(MockDockerClient)
+
+		_, err := getMailserverContainer(context.Background(), mockClient)
+		assert.ErrorIs(t, err, errMailserverNotRunning)
+		assert.Equal(t, http.StatusServiceUnavailable, containerErrorStatus(err))
+		mockClient.AssertNotCalled(t, "ContainerList", mock.Anything, mock.Anything)
+	})
+
+	t.Run("getMailserverContainer should return the watched container", func(t *testing.T) {
+		newSyncedWatcher(t, mailserverState{ID: "containerId", Name: "mailserver", Image: "mailserver/docker-mailserver", State: "running"})
+		mockClient := new(MockDockerClient)
+
+		container, err := getMailserverContainer(context.Background(), mockClient)
+		assert.NoError(t, err)
+		assert.Equal(t, "containerId", container.ID)
+		mockClient.AssertNotCalled(t, "ContainerList", mock.Anything, mock.Anything)
+	})
+
+	t.Run("status should report the watched container health", func(t *testing.T) {
+		newSyncedWatcher(t, mailserverState{ID: "containerId", State: "running", Health: "unhealthy"})
+		mockClient := new(MockDockerClient)
+		mockClient.On("ContainerInspect", mock.Anything, "containerId").Return(nil, errors.New("inspect error"))
+		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("exec error"))
+
+		router := gin.Default()
+		router.GET("/v1/status", func(c *gin.Context) {
+			checkIfContainerIsRunning(c, mockClient)
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/status", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"running": true, "health": "unhealthy"}`, w.Body.String())
+	})
+}
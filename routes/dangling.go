@@ -0,0 +1,325 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+)
+
+const (
+	danglingActionDelete   = "delete"
+	danglingActionRetarget = "retarget"
+)
+
+// danglingAliasCount is the number of dangling aliases found by the last
+// check, nil until the first check succeeded.
+var danglingAliasCount atomic.Pointer[int]
+
+// DanglingAliasesGetHandler godoc
+//
+//	@Summary	List of dangling email aliases
+//	@Schemes
+//	@Description	Gets all aliases that end at an address of a hosted domain which is neither a mailbox nor another alias, e.g. because the mailbox was deleted
+//	@Tags			Aliases
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	models.DanglingAliasesResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Failure		503	{object}	models.ErrorResponse
+//	@Failure		504	{object}	models.ErrorResponse
+//	@Failure		429	{object}	models.ErrorResponse
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Router			/v1/aliases/dangling [get]
+func (h *Handler) DanglingAliasesGetHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	container, err := getMailserverContainer(ctx, h.docker)
+	if err != nil {
+		c.JSON(containerErrorStatus(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	_, dangling, err := getDanglingAliases(ctx, h.docker, container.ID)
+	if err != nil {
+		c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(200, models.DanglingAliasesResponse{Aliases: filterAllowedDomains(ctx, dangling, danglingAddress)})
+}
+
+// DanglingAliasesPostHandler godoc
+//
+//	@Summary	Clean up dangling email aliases
+//	@Schemes
+//	@Description	Deletes dangling aliases or retargets them to an existing email address. Without a list of aliases, "delete" removes all dangling aliases and "retarget" changes the aliases pointing directly at a missing address, which also fixes the aliases forwarding to them.
+//	@Tags			Aliases
+//	@Accept			json
+//	@Produce		json
+//	@Param			cleanup			body		models.DanglingCleanupRequest	true	"Action and aliases to clean up"
+//	@Param			If-Match		header		string							false	"ETag of the alias set from GET /v1/aliases, fails with 412 if the aliases were changed"
+//	@Param			Idempotency-Key	header		string							false	"Key to safely retry the request, the response is replayed for retries"
+//	@Success		200				{object}	models.DanglingCleanupResponse
+//	@Failure		400				{object}	models.ErrorResponse
+//	@Failure		412				{object}	models.ErrorResponse
+//	@Failure		413				{object}	models.ErrorResponse
+//	@Failure		422				{object}	models.ErrorResponse
+//	@Failure		500				{object}	models.ErrorResponse
+//	@Failure		503				{object}	models.ErrorResponse
+//	@Failure		504				{object}	models.ErrorResponse
+//	@Failure		429				{object}	models.ErrorResponse
+//	@Failure		403				{object}	models.ErrorResponse
+//	@Failure		401				{object}	models.ErrorResponse
+//	@Router			/v1/aliases/dangling [post]
+func (h *Handler) DanglingAliasesPostHandler(c *gin.Context) {
+	var request models.DanglingCleanupRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, models.ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if request.Action == danglingActionRetarget && request.Email == "" {
+		c.JSON(400, models.ErrorResponse{Error: "Email must be provided"})
+		return
+	}
+	if request.Action == danglingActionRetarget && !checkDomainAllowed(c, request.Email) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	container, err := getMailserverContainer(ctx, h.docker)
+	if err != nil {
+		c.JSON(containerErrorStatus(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	unlock, err := mailserverLock.acquire(ctx, container.ID, models.GetLockTimeout())
+	if err != nil {
+		c.JSON(lockErrorStatus(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	defer unlock()
+
+	if !checkIfMatch(c, h.docker, container.ID) {
+		return
+	}
+
+	aliases, dangling, err := getDanglingAliases(ctx, h.docker, container.ID)
+	if err != nil {
+		c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if request.Action == danglingActionRetarget {
+		emailExists, err := checkIfEmailExists(ctx, h.docker, container.ID, request.Email)
+		if err != nil {
+			c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
+			return
+		}
+		_, aliasExistsErr := checkIfAliasExists(ctx, h.docker, container.ID, request.Email)
+		if !emailExists && aliasExistsErr != nil {
+			c.JSON(400, models.ErrorResponse{Error: "Email does not exist"})
+			return
+		}
+	}
+
+	// Aliases of other domains are not dangling for the API token, so that it
+	// learns nothing about them
+	visible := filterAllowedDomains(ctx, dangling, danglingAddress)
+	selected, response := selectDanglingAliases(visible, request)
+	for _, alias := range selected {
+		var err error
+		if request.Action == danglingActionDelete {
+			err = deleteAlias(ctx, h.docker, container.ID, alias)
+		} else {
+			aliases, err = retargetAlias(ctx, h.docker, container.ID, aliases, alias, request.Email)
+		}
+
+		if err != nil {
+			response.Failed = append(response.Failed, models.AliasFailedResponse{Alias: alias.Alias, Error: err.Error()})
+			continue
+		}
+		response.Updated = append(response.Updated, alias)
+	}
+
+	mailserverCache.invalidate(container.ID)
+	if len(response.Updated) > 0 {
+		eventBroadcaster.publish(models.EventResponse{Type: eventAliasesChanged})
+	}
+	if _, _, err := getDanglingAliases(ctx, h.docker, container.ID); err != nil {
+		logger(ctx).Warn("failed to recount dangling aliases", slog.String("error", err.Error()))
+	}
+
+	c.JSON(200, response)
+}
+
+// selectDanglingAliases returns the dangling aliases the cleanup request
+// applies to. Requested aliases that are not dangling are reported as failed.
+func selectDanglingAliases(dangling []models.DanglingAliasResponse, request models.DanglingCleanupRequest) ([]models.AliasResponse, models.DanglingCleanupResponse) {
+	response := models.DanglingCleanupResponse{
+		Updated: make([]models.AliasResponse, 0),
+		Failed:  make([]models.AliasFailedResponse, 0),
+	}
+
+	selected := make([]models.AliasResponse, 0)
+	if len(request.Aliases) == 0 {
+		for _, d := range dangling {
+			if request.Action == danglingActionRetarget && d.Email != d.Missing {
+				continue
+			}
+			selected = append(selected, models.AliasResponse{Alias: d.Alias, Email: d.Email})
+		}
+		return selected, response
+	}
+
+	for _, alias := range request.Aliases {
+		i := slices.IndexFunc(dangling, func(d models.DanglingAliasResponse) bool {
+			return strings.EqualFold(d.Alias, alias)
+		})
+		if i < 0 {
+			response.Failed = append(response.Failed, models.AliasFailedResponse{Alias: alias, Error: "Alias is not dangling"})
+			continue
+		}
+		selected = append(selected, models.AliasResponse{Alias: dangling[i].Alias, Email: dangling[i].Email})
+	}
+	return selected, response
+}
+
+// retargetAlias replaces the destination of the alias and returns the updated
+// list of aliases. The original alias is restored if the new one cannot be
+// added.
+func retargetAlias(ctx context.Context, cli DockerClient, containerName string, aliases []models.AliasResponse, alias models.AliasResponse, email string) ([]models.AliasResponse, error) {
+	retargeted := models.AliasResponse{Alias: alias.Alias, Email: email}
+	if err := validateAliasChain(aliases, retargeted, models.GetAliasMaxDepth()); err != nil {
+		return aliases, err
+	}
+
+	if err := deleteAlias(ctx, cli, containerName, alias); err != nil {
+		return aliases, err
+	}
+	result := slices.DeleteFunc(slices.Clone(aliases), func(a models.AliasResponse) bool {
+		return strings.EqualFold(a.Alias, alias.Alias)
+	})
+	if err := addAlias(ctx, cli, containerName, retargeted); err != nil {
+		if restoreErr := addAlias(ctx, cli, containerName, alias); restoreErr != nil {
+			return result, errors.Join(err, fmt.Errorf("failed to restore alias to %s: %w", alias.Email, restoreErr))
+		}
+		return aliases, err
+	}
+
+	return append(result, retargeted), nil
+}
+
+// getDanglingAliases reads the aliases and mailboxes, returns the aliases and
+// the dangling ones among them and updates the dangling alias count.
+func getDanglingAliases(ctx context.Context, cli DockerClient, containerName string) ([]models.AliasResponse, []models.DanglingAliasResponse, error) {
+	aliases, err := mailserverCache.getAliases(ctx, cli, containerName, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	emails, err := mailserverCache.getEmails(ctx, cli, containerName, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dangling := findDanglingAliases(aliases.Aliases, emails)
+	setDanglingAliasCount(len(dangling))
+	return aliases.Aliases, dangling, nil
+}
+
+// findDanglingAliases follows the chain of every alias and returns the aliases
+// ending at an address that is neither a mailbox nor an alias. Only addresses
+// of hosted domains are considered missing, as aliases may forward to
+// external addresses. Aliases in loops are skipped, see findAliasCycles.
+func findDanglingAliases(aliases []models.AliasResponse, emails []string) []models.DanglingAliasResponse {
+	graph := make(map[string]models.AliasResponse, len(aliases))
+	for _, alias := range aliases {
+		graph[strings.ToLower(alias.Alias)] = alias
+	}
+
+	mailboxes := make(map[string]bool, len(emails))
+	for _, email := range emails {
+		mailboxes[strings.ToLower(email)] = true
+	}
+	domains := hostedDomains(emails)
+
+	result := make([]models.DanglingAliasResponse, 0)
+	for _, alias := range aliases {
+		path := []string{alias.Alias}
+		visited := map[string]bool{strings.ToLower(alias.Alias): true}
+
+		for address := alias.Email; ; {
+			key := strings.ToLower(address)
+			if mailboxes[key] || visited[key] {
+				break
+			}
+			path = append(path, address)
+			visited[key] = true
+
+			next, ok := graph[key]
+			if !ok {
+				if isHostedDomain(domains, address) {
+					result = append(result, models.DanglingAliasResponse{
+						Alias:   alias.Alias,
+						Email:   alias.Email,
+						Missing: address,
+						Path:    path,
+					})
+				}
+				break
+			}
+			address = next.Email
+		}
+	}
+
+	slices.SortFunc(result, func(a, b models.DanglingAliasResponse) int {
+		return compareFold(a.Alias, b.Alias)
+	})
+	return result
+}
+
+func setDanglingAliasCount(count int) {
+	danglingAliasCount.Store(&count)
+	danglingAliases.Set(float64(count))
+}
+
+// CheckDanglingAliases counts the dangling aliases every
+// DANGLING_CHECK_INTERVAL for the status and metrics until the context is
+// cancelled.
+func (h *Handler) CheckDanglingAliases(ctx context.Context) {
+	interval := models.GetDanglingCheckInterval()
+	if interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := checkDanglingAliases(ctx, h.docker); err != nil && ctx.Err() == nil {
+			slog.Warn("Dangling alias check failed", slog.String("error", err.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func checkDanglingAliases(ctx context.Context, cli DockerClient) error {
+	container, err := getMailserverContainer(ctx, cli)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = getDanglingAliases(ctx, cli, container.ID)
+	return err
+}
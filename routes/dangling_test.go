@@ -0,0 +1,185 @@
+package routes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDanglingAliases(t *testing.T) {
+	emails := []string{"admin@website.de", "team@website.de"}
+	aliases := []models.AliasResponse{
+		{Alias: "postmaster@website.de", Email: "admin@website.de"},
+		{Alias: "old@website.de", Email: "removed@website.de"},
+		{Alias: "sales@website.de", Email: "old@website.de"},
+		{Alias: "forward@website.de", Email: "someone@gmail.com"},
+		{Alias: "a@website.de", Email: "b@website.de"},
+		{Alias: "b@website.de", Email: "a@website.de"},
+	}
+
+	t.Run("findDanglingAliases should return aliases ending at missing addresses of hosted domains", func(t *testing.T) {
+		assert.Equal(t, []models.DanglingAliasResponse{
+			{Alias: "old@website.de", Email: "removed@website.de", Missing: "removed@website.de", Path: []string{"old@website.de", "removed@website.de"}},
+			{Alias: "sales@website.de", Email: "old@website.de", Missing: "removed@website.de", Path: []string{"sales@website.de", "old@website.de", "removed@website.de"}},
+		}, findDanglingAliases(aliases, emails))
+	})
+
+	t.Run("selectDanglingAliases should delete all dangling aliases by default", func(t *testing.T) {
+		selected, response := selectDanglingAliases(findDanglingAliases(aliases, emails), models.DanglingCleanupRequest{Action: danglingActionDelete})
+		assert.Equal(t, []models.AliasResponse{aliases[1], aliases[2]}, selected)
+		assert.Empty(t, response.Failed)
+	})
+
+	t.Run("selectDanglingAliases should only retarget aliases pointing at the missing address by default", func(t *testing.T) {
+		selected, _ := selectDanglingAliases(findDanglingAliases(aliases, emails), models.DanglingCleanupRequest{Action: danglingActionRetarget, Email: "team@website.de"})
+		assert.Equal(t, []models.AliasResponse{aliases[1]}, selected)
+	})
+
+	t.Run("selectDanglingAliases should report requested aliases that are not dangling", func(t *testing.T) {
+		selected, response := selectDanglingAliases(findDanglingAliases(aliases, emails), models.DanglingCleanupRequest{
+			Action:  danglingActionDelete,
+			Aliases: []string{"Sales@website.de", "postmaster@website.de"},
+		})
+		assert.Equal(t, []models.AliasResponse{aliases[2]}, selected)
+		assert.Equal(t, []models.AliasFailedResponse{{Alias: "postmaster@website.de", Error: "Alias is not dangling"}}, response.Failed)
+	})
+
+	t.Run("retargetAlias should replace the alias", func(t *testing.T) {
+		mockClient := newAliasListMock("")
+
+		result, err := retargetAlias(context.Background(), mockClient, "containerId", aliases[:3], aliases[1], "team@website.de")
+		assert.NoError(t, err)
+		assert.Contains(t, result, models.AliasResponse{Alias: "old@website.de", Email: "team@website.de"})
+		assert.NotContains(t, result, aliases[1])
+		mockClient.AssertNumberOfCalls(t, "ContainerExecCreate", 2)
+	})
+
+	t.Run("retargetAlias should not change the alias on errors", func(t *testing.T) {
+		mockClient := new(MockDockerClient)
+		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{}, errors.New("exec create error"))
+
+		result, err := retargetAlias(context.Background(), mockClient, "containerId", aliases[:3], aliases[1], "team@website.de")
+		assert.Error(t, err)
+		assert.Equal(t, aliases[:3], result)
+
+		_, err = retargetAlias(context.Background(), mockClient, "containerId", aliases[:3], aliases[1], "sales@website.de")
+		assert.True(t, errors.Is(err, errAliasLoop))
+	})
+
+	t.Run("retargetAlias should restore the alias if the new one cannot be added", func(t *testing.T) {
+		newRetargetMock := func(failing ...[]string) *MockDockerClient {
+			mockHijackedResponseConn := new(MockHijackedResponseConn)
+			mockHijackedResponseConn.On("Close").Return(nil)
+
+			mockClient := new(MockDockerClient)
+			for _, cmd := range failing {
+				mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.MatchedBy(func(options container.ExecOptions) bool {
+					return slices.Equal(options.Cmd, cmd)
+				})).Return(types.IDResponse{}, errors.New("exec create error"))
+			}
+			mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{ID: "execId"}, nil)
+			mockClient.On("ContainerExecAttach", mock.Anything, mock.Anything, mock.Anything).Return(types.HijackedResponse{
+				Reader: bufio.NewReader(bytes.NewBufferString("")),
+				Conn:   mockHijackedResponseConn,
+			}, nil)
+			mockClient.On("ContainerExecInspect", mock.Anything, mock.Anything).Return(container.ExecInspect{ExitCode: 0}, nil)
+			return mockClient
+		}
+		add := []string{"setup", "alias", "add", "old@website.de", "team@website.de"}
+		restore := []string{"setup", "alias", "add", "old@website.de", "removed@website.de"}
+
+		mockClient := newRetargetMock(add)
+		result, err := retargetAlias(context.Background(), mockClient, "containerId", aliases[:3], aliases[1], "team@website.de")
+		assert.EqualError(t, err, "exec create error")
+		assert.Equal(t, aliases[:3], result)
+		mockClient.AssertNumberOfCalls(t, "ContainerExecCreate", 3)
+
+		mockClient = newRetargetMock(add, restore)
+		result, err = retargetAlias(context.Background(), mockClient, "containerId", aliases[:3], aliases[1], "team@website.de")
+		assert.EqualError(t, err, "exec create error\nfailed to restore alias to removed@website.de: exec create error")
+		assert.NotContains(t, result, aliases[1])
+	})
+
+	t.Run("POST should only clean up dangling aliases of the domains of the API token", func(t *testing.T) {
+		t.Cleanup(mailserverCache.invalidateAll)
+		t.Cleanup(mailserverWatcher.reset)
+		t.Cleanup(func() { danglingAliasCount.Store(nil) })
+
+		newCleanupMock := func() *MockDockerClient {
+			mockHijackedResponseConn := new(MockHijackedResponseConn)
+			mockHijackedResponseConn.On("Close").Return(nil)
+
+			mockClient := new(MockDockerClient)
+			mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
+				{ID: "cleanupId", Image: "mailserver/docker-mailserver"},
+			}, nil)
+			outputs := map[string]string{
+				"alias": "* old@website.de removed@website.de\n* old@other.de removed@other.de\n",
+				"email": "* admin@website.de ( 0 / ~ ) [0%]\n* admin@other.de ( 0 / ~ ) [0%]\n",
+			}
+			for kind, output := range outputs {
+				mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.MatchedBy(func(options container.ExecOptions) bool {
+					return slices.Equal(options.Cmd, []string{"setup", kind, "list"})
+				})).Return(types.IDResponse{ID: kind}, nil)
+				mockClient.On("ContainerExecAttach", mock.Anything, kind, mock.Anything).Return(types.HijackedResponse{
+					Reader: bufio.NewReader(bytes.NewBufferString(output)),
+					Conn:   mockHijackedResponseConn,
+				}, nil)
+			}
+			mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{ID: "execId"}, nil)
+			mockClient.On("ContainerExecAttach", mock.Anything, "execId", mock.Anything).Return(types.HijackedResponse{
+				Reader: bufio.NewReader(bytes.NewBufferString("")),
+				Conn:   mockHijackedResponseConn,
+			}, nil)
+			mockClient.On("ContainerExecInspect", mock.Anything, mock.Anything).Return(container.ExecInspect{ExitCode: 0}, nil)
+			return mockClient
+		}
+		newCleanupRouter := func(mockClient *MockDockerClient) *gin.Engine {
+			router := gin.New()
+			router.POST("/v1/aliases/dangling", func(c *gin.Context) {
+				a := actor{user: "token:ci", token: "ci", scopes: []string{ScopeAliasesWrite}, domains: []string{"website.de"}}
+				c.Request = c.Request.WithContext(withActor(c.Request.Context(), a))
+			}, NewHandler(mockClient).DanglingAliasesPostHandler)
+			return router
+		}
+
+		tests := []struct {
+			body         string
+			expectedCode int
+			expectedBody string
+		}{
+			{`{"action": "delete"}`, 200, `{"updated": [{"alias": "old@website.de", "email": "removed@website.de"}], "failed": []}`},
+			{`{"action": "delete", "aliases": ["old@other.de"]}`, 200, `{"updated": [], "failed": [{"alias": "old@other.de", "error": "Alias is not dangling"}]}`},
+			{`{"action": "retarget", "email": "admin@other.de"}`, 403, `{"error": "API token is not allowed to change aliases of other.de", "code": "domain_not_allowed"}`},
+		}
+
+		for _, tt := range tests {
+			mailserverCache.invalidateAll()
+			router := newCleanupRouter(newCleanupMock())
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/aliases/dangling", strings.NewReader(tt.body)))
+			assert.Equal(t, tt.expectedCode, w.Code, tt.body)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String(), tt.body)
+		}
+	})
+
+	t.Run("setDanglingAliasCount should update the status count", func(t *testing.T) {
+		t.Cleanup(func() { danglingAliasCount.Store(nil) })
+
+		setDanglingAliasCount(2)
+		assert.Equal(t, 2, *danglingAliasCount.Load())
+	})
+}
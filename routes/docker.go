@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"context"
+
+	"github.com/docker/docker/client"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+)
+
+// Handler serves the endpoints that talk to the Docker daemon. All requests
+// share its Docker client, so connections to the daemon are reused and the
+// API version is only negotiated once.
+type Handler struct {
+	docker DockerClient
+}
+
+// NewHandler returns a Handler using the Docker client. The client is owned by
+// the caller, which closes it on shutdown.
+func NewHandler(docker DockerClient) *Handler {
+	return &Handler{docker: docker}
+}
+
+// NewDockerClient creates the Docker client of the application from the
+// DOCKER_HOST, DOCKER_API_VERSION and DOCKER_CERT_PATH environment variables
+// and negotiates the API version with the daemon. If the daemon is not
+// reachable yet, the version is negotiated on the first request instead.
+func NewDockerClient(ctx context.Context) (*client.Client, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, models.GetDockerTimeout())
+	defer cancel()
+	cli.NegotiateAPIVersion(ctx)
+
+	return cli, nil
+}
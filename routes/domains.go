@@ -0,0 +1,60 @@
+package routes
+
+import (
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+)
+
+// DomainsGetHandler godoc
+//
+//	@Summary	List of hosted domains
+//	@Schemes
+//	@Description	Gets the domains hosted by the Docker Mailserver, i.e. the domains of its mailboxes and the domains configured with MAIL_DOMAINS
+//	@Tags			Domains
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	models.DomainListResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Failure		503	{object}	models.ErrorResponse
+//	@Failure		504	{object}	models.ErrorResponse
+//	@Failure		429	{object}	models.ErrorResponse
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Router			/v1/domains [get]
+func (h *Handler) DomainsGetHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	container, err := getMailserverContainer(ctx, h.docker)
+	if err != nil {
+		c.JSON(containerErrorStatus(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	emails, err := mailserverCache.getEmails(ctx, h.docker, container.ID, false)
+	if err != nil {
+		c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	domains := filterAllowedDomains(ctx, hostedDomains(emails), func(domain string) string {
+		return "postmaster@" + domain
+	})
+	c.JSON(200, models.DomainListResponse{Domains: domains})
+}
+
+// hostedDomains returns the sorted, lowercased domains of the mailboxes and
+// of MAIL_DOMAINS.
+func hostedDomains(emails []string) []string {
+	domains := models.GetMailDomains()
+	for _, email := range emails {
+		domains = append(domains, domainOf(email))
+	}
+
+	slices.Sort(domains)
+	return slices.Compact(domains)
+}
+
+func isHostedDomain(domains []string, address string) bool {
+	_, found := slices.BinarySearch(domains, domainOf(address))
+	return found
+}
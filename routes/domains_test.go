@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostedDomains(t *testing.T) {
+	t.Run("hostedDomains should return the sorted domains of the mailboxes", func(t *testing.T) {
+		domains := hostedDomains([]string{"admin@website.de", "name@Developer.de", "team@website.de"})
+		assert.Equal(t, []string{"developer.de", "website.de"}, domains)
+	})
+
+	t.Run("hostedDomains should include configured domains", func(t *testing.T) {
+		t.Setenv("MAIL_DOMAINS", "example.com,website.de")
+
+		domains := hostedDomains([]string{"admin@website.de"})
+		assert.Equal(t, []string{"example.com", "website.de"}, domains)
+	})
+
+	t.Run("isHostedDomain should compare the domain case-insensitively", func(t *testing.T) {
+		domains := []string{"developer.de", "website.de"}
+
+		assert.True(t, isHostedDomain(domains, "info@Website.de"))
+		assert.False(t, isHostedDomain(domains, "info@exmaple.com"))
+	})
+}
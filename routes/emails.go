@@ -1,14 +1,11 @@
 package routes
 
 import (
-	"bytes"
 	"context"
-	"io"
 	"net/mail"
 	"regexp"
 	"strings"
 
-	"github.com/docker/docker/api/types/container"
 	"github.com/gin-gonic/gin"
 	"github.com/scheidti/docker-mailserver-aliases/models"
 )
@@ -17,62 +14,106 @@ import (
 //
 //	@Summary	List of all available email addresses
 //	@Schemes
-//	@Description	Gets a list of all available email addresses from the Docker Mailserver container
+//	@Description	Gets a list of all available email addresses from the Docker Mailserver container, optionally searched, filtered, sorted and paginated
 //	@Tags			E-Mails
 //	@Accept			json
 //	@Produce		json
-//	@Success		200	{object}	models.EmailListResponse
-//	@Failure		500	{object}	models.ErrorResponse
+//	@Param			fresh	query		bool	false	"Bypass the cache and read the email addresses from the container"
+//	@Param			q		query		string	false	"Search email addresses, as substring or glob with * and ?"
+//	@Param			domain	query		string	false	"Only email addresses of this domain"
+//	@Param			sort	query		string	false	"Sort field"									Enums(email, domain)	default(email)
+//	@Param			order	query		string	false	"Sort order"									Enums(asc, desc)		default(asc)
+//	@Param			limit	query		int		false	"Maximum number of email addresses, 0 for all"	maximum(1000)
+//	@Param			offset	query		int		false	"Number of email addresses to skip"
+//	@Success		200		{object}	models.EmailListResponse
+//	@Failure		400		{object}	models.ErrorResponse
+//	@Failure		500		{object}	models.ErrorResponse
+//	@Failure		503		{object}	models.ErrorResponse
+//	@Failure		504		{object}	models.ErrorResponse
+//	@Failure		429		{object}	models.ErrorResponse
+//	@Failure		401		{object}	models.ErrorResponse
+//	@Failure		403		{object}	models.ErrorResponse
 //	@Router			/v1/emails [get]
-func EmailsGetHandler(c *gin.Context) {
-	cli, err := getDockerClient()
+func (h *Handler) EmailsGetHandler(c *gin.Context) {
+	options, err := parseListOptions(c, "email", "domain")
 	if err != nil {
-		c.JSON(500, models.ErrorResponse{Error: err.Error()})
+		c.JSON(400, models.ErrorResponse{Error: err.Error()})
 		return
 	}
-	defer cli.Close()
 
-	container, err := getMailserverContainer(cli)
+	ctx := c.Request.Context()
+	container, err := getMailserverContainer(ctx, h.docker)
 	if err != nil {
-		c.JSON(500, models.ErrorResponse{Error: err.Error()})
+		c.JSON(containerErrorStatus(err), models.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	emails, err := getEmails(cli, container.ID)
+	emails, err := mailserverCache.getEmails(ctx, h.docker, container.ID, c.Query("fresh") == "true")
 	if err != nil {
-		c.JSON(500, models.ErrorResponse{Error: err.Error()})
+		c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
 		return
 	}
-	c.JSON(200, models.EmailListResponse{Emails: emails})
+	c.JSON(200, listEmails(filterAllowedDomains(ctx, emails, emailAddress), options))
 }
 
-func getEmails(cli DockerClient, containerName string) ([]string, error) {
-	ctx := context.Background()
+// EmailAliasesGetHandler godoc
+//
+//	@Summary	Aliases reaching an email address
+//	@Schemes
+//	@Description	Gets all aliases that forward to the email address, directly or through other aliases, with the path through the alias chain
+//	@Tags			E-Mails
+//	@Accept			json
+//	@Produce		json
+//	@Param			email	path		string	true	"Email address"
+//	@Success		200		{object}	models.MailboxAliasesResponse
+//	@Failure		404		{object}	models.ErrorResponse
+//	@Failure		500		{object}	models.ErrorResponse
+//	@Failure		503		{object}	models.ErrorResponse
+//	@Failure		504		{object}	models.ErrorResponse
+//	@Failure		429		{object}	models.ErrorResponse
+//	@Failure		401		{object}	models.ErrorResponse
+//	@Failure		403		{object}	models.ErrorResponse
+//	@Router			/v1/emails/{email}/aliases [get]
+func (h *Handler) EmailAliasesGetHandler(c *gin.Context) {
+	email := c.Param("email")
 
-	execConfig := container.ExecOptions{
-		Cmd:          []string{"setup", "email", "list"},
-		AttachStdout: true,
-		AttachStderr: true,
+	ctx := c.Request.Context()
+	container, err := getMailserverContainer(ctx, h.docker)
+	if err != nil {
+		c.JSON(containerErrorStatus(err), models.ErrorResponse{Error: err.Error()})
+		return
 	}
 
-	execId, err := cli.ContainerExecCreate(ctx, containerName, execConfig)
+	emailExists, err := checkIfEmailExists(ctx, h.docker, container.ID, email)
 	if err != nil {
-		return nil, err
+		c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	// Mailboxes of other domains are hidden from tokens limited to domains
+	if !emailExists || len(filterAllowedDomains(ctx, []string{email}, emailAddress)) == 0 {
+		c.JSON(404, models.ErrorResponse{Error: "Email not found"})
+		return
 	}
 
-	resp, err := cli.ContainerExecAttach(ctx, execId.ID, container.ExecStartOptions{})
+	aliases, err := mailserverCache.getAliases(ctx, h.docker, container.ID, false)
 	if err != nil {
-		return nil, err
+		c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
+		return
 	}
-	defer resp.Close()
 
-	var outBuf, _ bytes.Buffer
-	_, err = io.Copy(&outBuf, resp.Reader)
+	visible := filterAllowedDomains(ctx, aliases.Aliases, aliasAddress)
+	c.JSON(200, models.MailboxAliasesResponse{Email: email, Aliases: aliasesReaching(visible, email)})
+}
+
+func getEmails(ctx context.Context, cli DockerClient, containerName string) ([]string, error) {
+	output, err := runSetupCommand(ctx, cli, containerName, "email", "list")
 	if err != nil {
 		return nil, err
 	}
 
-	return parseEmailCommandResult(outBuf.String()), nil
+	emails := parseEmailCommandResult(output)
+	observeMailboxes(emails)
+	return emails, nil
 }
 
 func parseEmailCommandResult(commandResult string) []string {
@@ -3,11 +3,13 @@ package routes
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"io"
 	"testing"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -32,8 +34,9 @@ func TestEmailsGetHandler(t *testing.T) {
 			Reader: bufio.NewReader(io.NopCloser(bytes.NewBufferString("* name@developer.de ( 969K / ~ ) [0%] [ aliases -> postmaster@mail.de ]"))),
 			Conn:   mockHijackedResponseConn,
 		}, nil)
+		mockClient.On("ContainerExecInspect", mock.Anything, mock.Anything).Return(container.ExecInspect{ExitCode: 0}, nil)
 
-		emails, err := getEmails(mockClient, "containerId")
+		emails, err := getEmails(context.Background(), mockClient, "containerId")
 		assert.NoError(t, err)
 		assert.Equal(t, []string{"name@developer.de"}, emails)
 	})
@@ -42,7 +45,7 @@ func TestEmailsGetHandler(t *testing.T) {
 		mockClient := new(MockDockerClient)
 		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{}, errors.New("exec create error"))
 
-		emails, err := getEmails(mockClient, "containerId")
+		emails, err := getEmails(context.Background(), mockClient, "containerId")
 		assert.Error(t, err)
 		assert.Nil(t, emails)
 	})
@@ -52,7 +55,7 @@ func TestEmailsGetHandler(t *testing.T) {
 		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{ID: "execId"}, nil)
 		mockClient.On("ContainerExecAttach", mock.Anything, mock.Anything, mock.Anything).Return(types.HijackedResponse{}, errors.New("exec attach error"))
 
-		emails, err := getEmails(mockClient, "containerId")
+		emails, err := getEmails(context.Background(), mockClient, "containerId")
 		assert.Error(t, err)
 		assert.Nil(t, emails)
 	})
@@ -66,8 +69,9 @@ func TestEmailsGetHandler(t *testing.T) {
 			Reader: bufio.NewReader(io.NopCloser(&errorReader{})),
 			Conn:   mockHijackedResponseConn,
 		}, nil)
+		mockClient.On("ContainerExecInspect", mock.Anything, mock.Anything).Return(container.ExecInspect{ExitCode: 0}, nil)
 
-		emails, err := getEmails(mockClient, "containerId")
+		emails, err := getEmails(context.Background(), mockClient, "containerId")
 		assert.Error(t, err)
 		assert.Nil(t, emails)
 	})
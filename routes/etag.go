@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+)
+
+const errorCodePreconditionFailed = "precondition_failed"
+
+// aliasesETag returns a strong ETag over the set of aliases, independent of
+// their order.
+func aliasesETag(aliases []models.AliasResponse) string {
+	lines := make([]string, len(aliases))
+	for i, alias := range aliases {
+		lines[i] = strings.ToLower(alias.Alias) + " " + strings.ToLower(alias.Email)
+	}
+	slices.Sort(lines)
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether the ETag is one of the ETags of an If-Match or
+// If-None-Match header. "*" matches any ETag.
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch compares the If-Match header of a change with the current
+// aliases the request may read. If the aliases were changed in the meantime,
+// it responds with 412 and returns false.
+func checkIfMatch(c *gin.Context, cli DockerClient, containerName string) bool {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		return true
+	}
+
+	aliases, err := mailserverCache.getAliases(c.Request.Context(), cli, containerName, false)
+	if err != nil {
+		c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
+		return false
+	}
+
+	etag := aliasesETag(filterAllowedDomains(c.Request.Context(), aliases.Aliases, aliasAddress))
+	if !etagMatches(ifMatch, etag) {
+		c.Header("ETag", etag)
+		c.JSON(412, models.ErrorResponse{Error: "Aliases have been changed in the meantime", Code: errorCodePreconditionFailed})
+		return false
+	}
+	return true
+}
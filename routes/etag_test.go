@@ -0,0 +1,60 @@
+package routes
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAliasesETag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	aliases := []models.AliasResponse{
+		{Alias: "postmaster@website.de", Email: "admin@website.de"},
+		{Alias: "info@website.de", Email: "team@website.de"},
+	}
+
+	t.Run("aliasesETag should not depend on the order of the aliases", func(t *testing.T) {
+		etag := aliasesETag(aliases)
+		assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag)
+		assert.Equal(t, etag, aliasesETag([]models.AliasResponse{aliases[1], aliases[0]}))
+		assert.NotEqual(t, etag, aliasesETag(aliases[:1]))
+	})
+
+	t.Run("etagMatches should check all ETags of the header", func(t *testing.T) {
+		assert.True(t, etagMatches(`"a", "b"`, `"b"`))
+		assert.True(t, etagMatches(`*`, `"b"`))
+		assert.False(t, etagMatches(`"a"`, `"b"`))
+	})
+
+	t.Run("checkIfMatch should return 412 if the aliases were changed", func(t *testing.T) {
+		t.Cleanup(mailserverCache.invalidateAll)
+		mailserverCache.aliases["etagId"] = cacheEntry[[]models.AliasResponse]{value: aliases, expires: time.Now().Add(time.Hour)}
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("DELETE", "/v1/aliases/info@website.de", nil)
+		c.Request.Header.Set("If-Match", `"outdated"`)
+
+		assert.False(t, checkIfMatch(c, new(MockDockerClient), "etagId"))
+		assert.Equal(t, 412, w.Code)
+		assert.Equal(t, aliasesETag(aliases), w.Header().Get("ETag"))
+		assert.JSONEq(t, `{"error": "Aliases have been changed in the meantime", "code": "precondition_failed"}`, w.Body.String())
+	})
+
+	t.Run("checkIfMatch should pass with the current ETag or without header", func(t *testing.T) {
+		t.Cleanup(mailserverCache.invalidateAll)
+		mailserverCache.aliases["etagId"] = cacheEntry[[]models.AliasResponse]{value: aliases, expires: time.Now().Add(time.Hour)}
+
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("DELETE", "/v1/aliases/info@website.de", nil)
+		assert.True(t, checkIfMatch(c, new(MockDockerClient), "etagId"))
+
+		c.Request.Header.Set("If-Match", aliasesETag(aliases))
+		assert.True(t, checkIfMatch(c, new(MockDockerClient), "etagId"))
+	})
+}
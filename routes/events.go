@@ -0,0 +1,155 @@
+package routes
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+)
+
+const eventsReconnectDelay = 5 * time.Second
+
+// runningChanges maps the exec IDs of modifying setup commands to the
+// resource they change, between their exec_start and exec_die events. It is
+// only used by the goroutine consuming the events.
+var runningChanges = make(map[string]string)
+
+// WatchDockerEvents subscribes to the Docker events stream to keep track of
+// the mailserver container and to invalidate the cached alias and email lists
+// whenever the container changes or its accounts are modified from outside of
+// this application. The stream is re-established after errors until the
+// context is cancelled.
+func (h *Handler) WatchDockerEvents(ctx context.Context) {
+	for {
+		err := consumeDockerEvents(ctx, h.docker)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("Docker events stream failed, reconnecting",
+			slog.Duration("delay", eventsReconnectDelay),
+			slog.String("error", err.Error()),
+		)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventsReconnectDelay):
+		}
+
+		// The stream fails when the daemon restarts, which might have been
+		// an upgrade to another API version
+		negotiateCtx, cancel := context.WithTimeout(ctx, models.GetDockerTimeout())
+		h.docker.NegotiateAPIVersion(negotiateCtx)
+		cancel()
+	}
+}
+
+func consumeDockerEvents(ctx context.Context, cli DockerClient) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	messages, errs := cli.Events(ctx, events.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("type", string(events.ContainerEventType))),
+	})
+
+	// Events might have been missed while the stream was down
+	mailserverCache.invalidateAll()
+	clear(runningChanges)
+	if err := mailserverWatcher.sync(ctx, cli); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case message := <-messages:
+			if !isMailserverEvent(message) {
+				continue
+			}
+			handleDockerEvent(message)
+			if mailserverWatcher.apply(message) {
+				if err := mailserverWatcher.sync(ctx, cli); err != nil {
+					return err
+				}
+			}
+		case err := <-errs:
+			mailserverWatcher.reset()
+			return err
+		}
+	}
+}
+
+func isMailserverEvent(message events.Message) bool {
+	return message.Type == events.ContainerEventType &&
+		strings.Contains(message.Actor.Attributes["image"], models.GetDockerImage())
+}
+
+func handleDockerEvent(message events.Message) {
+	if !isMailserverEvent(message) {
+		return
+	}
+
+	switch message.Action {
+	case events.ActionStart, events.ActionRestart, events.ActionDie, events.ActionDestroy:
+		mailserverCache.invalidate(message.Actor.ID)
+		return
+	case events.ActionExecDie:
+		// The change has been written only now, lists read since its start
+		// might not contain it
+		execID := message.Actor.Attributes["execID"]
+		if resource, ok := runningChanges[execID]; ok {
+			delete(runningChanges, execID)
+			mailserverCache.invalidate(message.Actor.ID)
+			publishChange(resource)
+		}
+		return
+	}
+
+	resource := modifiedSetupResource(string(message.Action))
+	if resource == "" {
+		return
+	}
+	mailserverCache.invalidate(message.Actor.ID)
+	if execID := message.Actor.Attributes["execID"]; execID != "" {
+		runningChanges[execID] = resource
+		return
+	}
+	publishChange(resource)
+}
+
+// publishChange notifies the clients that aliases or accounts were changed.
+func publishChange(resource string) {
+	switch resource {
+	case "alias":
+		eventBroadcaster.publish(models.EventResponse{Type: eventAliasesChanged})
+	case "email":
+		eventBroadcaster.publish(models.EventResponse{Type: eventMailboxesChanged})
+	}
+}
+
+// modifiedSetupResource returns "alias" or "email" if an exec_start event
+// action like "exec_start: setup alias add a@b.c d@b.c" changes aliases or
+// accounts, and an empty string otherwise.
+func modifiedSetupResource(action string) string {
+	command, found := strings.CutPrefix(action, string(events.ActionExecStart)+":")
+	if !found {
+		return ""
+	}
+
+	fields := strings.Fields(command)
+	if len(fields) < 3 || fields[0] != "setup" {
+		return ""
+	}
+
+	switch fields[1] {
+	case "alias", "email":
+		if fields[2] != "list" {
+			return fields[1]
+		}
+	}
+
+	return ""
+}
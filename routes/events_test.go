@@ -0,0 +1,124 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDockerEvents(t *testing.T) {
+	t.Run("modifiedSetupResource should detect modifying setup commands", func(t *testing.T) {
+		tests := []struct {
+			action   string
+			expected string
+		}{
+			{"exec_start: setup alias add info@website.de admin@website.de", "alias"},
+			{"exec_start: setup alias del info@website.de admin@website.de", "alias"},
+			{"exec_start: setup email add user@website.de password", "email"},
+			{"exec_start: setup email del user@website.de", "email"},
+			{"exec_start: setup alias list", ""},
+			{"exec_start: setup email list", ""},
+			{"exec_start: setup config dkim", ""},
+			{"exec_start: /bin/sh -c 'echo hello'", ""},
+			{"exec_create: setup alias add info@website.de admin@website.de", ""},
+			{"start", ""},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.action, func(t *testing.T) {
+				assert.Equal(t, tt.expected, modifiedSetupResource(tt.action))
+			})
+		}
+	})
+
+	t.Run("handleDockerEvent should invalidate the cache of the mailserver container", func(t *testing.T) {
+		t.Cleanup(mailserverCache.invalidateAll)
+		mailserverCache.aliases["containerId"] = cacheEntry[[]models.AliasResponse]{expires: time.Now().Add(time.Hour)}
+		mailserverCache.aliases["otherId"] = cacheEntry[[]models.AliasResponse]{expires: time.Now().Add(time.Hour)}
+
+		handleDockerEvent(events.Message{
+			Type:   events.ContainerEventType,
+			Action: "exec_start: setup alias add info@website.de admin@website.de",
+			Actor:  events.Actor{ID: "containerId", Attributes: map[string]string{"image": "mailserver/docker-mailserver:latest"}},
+		})
+
+		assert.NotContains(t, mailserverCache.aliases, "containerId")
+		assert.Contains(t, mailserverCache.aliases, "otherId")
+	})
+
+	t.Run("handleDockerEvent should broadcast changes made outside of the application", func(t *testing.T) {
+		t.Cleanup(mailserverCache.invalidateAll)
+		received, unsubscribe := eventBroadcaster.subscribe()
+		defer unsubscribe()
+
+		handleDockerEvent(events.Message{
+			Type:   events.ContainerEventType,
+			Action: "exec_start: setup email add user@website.de secret",
+			Actor:  events.Actor{ID: "containerId", Attributes: map[string]string{"image": "mailserver/docker-mailserver:latest"}},
+		})
+
+		assert.Equal(t, models.EventResponse{Type: eventMailboxesChanged}, <-received)
+	})
+
+	t.Run("handleDockerEvent should invalidate the cache again when a change finished", func(t *testing.T) {
+		t.Cleanup(mailserverCache.invalidateAll)
+		received, unsubscribe := eventBroadcaster.subscribe()
+		defer unsubscribe()
+		attributes := map[string]string{"image": "mailserver/docker-mailserver:latest", "execID": "execId"}
+
+		handleDockerEvent(events.Message{
+			Type:   events.ContainerEventType,
+			Action: "exec_start: setup alias add info@website.de admin@website.de",
+			Actor:  events.Actor{ID: "containerId", Attributes: attributes},
+		})
+		// Read by another request while the change is running
+		mailserverCache.aliases["containerId"] = cacheEntry[[]models.AliasResponse]{expires: time.Now().Add(time.Hour)}
+		assert.Empty(t, received)
+
+		handleDockerEvent(events.Message{
+			Type:   events.ContainerEventType,
+			Action: events.ActionExecDie,
+			Actor:  events.Actor{ID: "containerId", Attributes: attributes},
+		})
+
+		assert.NotContains(t, mailserverCache.aliases, "containerId")
+		assert.NotContains(t, runningChanges, "execId")
+		assert.Equal(t, models.EventResponse{Type: eventAliasesChanged}, <-received)
+	})
+
+	t.Run("handleDockerEvent should ignore events of other containers", func(t *testing.T) {
+		t.Cleanup(mailserverCache.invalidateAll)
+		mailserverCache.aliases["containerId"] = cacheEntry[[]models.AliasResponse]{expires: time.Now().Add(time.Hour)}
+
+		handleDockerEvent(events.Message{
+			Type:   events.ContainerEventType,
+			Action: events.ActionRestart,
+			Actor:  events.Actor{ID: "containerId", Attributes: map[string]string{"image": "test/some-other-image"}},
+		})
+
+		assert.Contains(t, mailserverCache.aliases, "containerId")
+	})
+
+	t.Run("consumeDockerEvents should return the stream error", func(t *testing.T) {
+		messages := make(chan events.Message)
+		errs := make(chan error, 1)
+		errs <- errors.New("stream error")
+
+		mockClient := new(MockDockerClient)
+		mockClient.On("Events", mock.Anything, mock.Anything).Return(messages, errs)
+		mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{}, nil)
+
+		err := consumeDockerEvents(context.Background(), mockClient)
+		assert.EqualError(t, err, "stream error")
+
+		_, synced, _ := mailserverWatcher.current()
+		assert.False(t, synced, "the watcher should not be used after the stream failed")
+	})
+}
@@ -0,0 +1,164 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// runSetupCommand runs the docker-mailserver setup CLI with the given
+// arguments inside of the container and returns its output. A non-zero exit
+// code of the command is returned as error. The command is abandoned when the
+// deadline of LIST_TIMEOUT or CHANGE_TIMEOUT is exceeded. List commands are
+// also abandoned when the context is done, changes are not, as the caller
+// holds the mutation lock while they run.
+func runSetupCommand(ctx context.Context, cli DockerClient, containerName string, args ...string) (string, error) {
+	subcommand := setupSubcommand(args)
+	cmd := append([]string{"setup"}, args...)
+	command := strings.Join(append([]string{"setup"}, redactSetupArgs(args)...), " ")
+
+	ctx, span := tracer.Start(ctx, "setup "+subcommand,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("mailserver.command", command),
+			attribute.String("container.id", containerName),
+		),
+	)
+	defer span.End()
+
+	if !isListCommand(args) {
+		ctx = context.WithoutCancel(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, setupCommandTimeout(args))
+	defer cancel()
+
+	log := logger(ctx).With(slog.String("command", command), slog.String("container_id", containerName))
+	log.Debug("running setup command")
+
+	start := time.Now()
+	output, exitCode, err := execCommand(ctx, cli, containerName, cmd)
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		err = fmt.Errorf("setup %s did not finish in time: %w", subcommand, ctx.Err())
+	case ctx.Err() != nil:
+		err = fmt.Errorf("setup %s was cancelled: %w", subcommand, ctx.Err())
+	case err == nil && exitCode != 0:
+		err = fmt.Errorf("setup %s failed with exit code %d: %s", subcommand, exitCode, strings.TrimSpace(output))
+	}
+	duration := time.Since(start)
+	observeExec(subcommand, duration, err)
+
+	attrs := []any{
+		slog.Duration("duration", duration),
+		slog.Int("exit_code", exitCode),
+		slog.Int("bytes", len(output)),
+	}
+	switch {
+	case err != nil:
+		log.Error("setup command failed", append(attrs, slog.String("error", err.Error()))...)
+	case isListCommand(args):
+		log.Debug("setup command finished", attrs...)
+	default:
+		log.Info("setup command finished", attrs...)
+	}
+
+	span.SetAttributes(
+		attribute.Int("process.exit.code", exitCode),
+		attribute.Int("mailserver.output.bytes", len(output)),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return output, err
+}
+
+func execCommand(ctx context.Context, cli DockerClient, containerName string, cmd []string) (string, int, error) {
+	execConfig := container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	}
+
+	createCtx, span := tracer.Start(ctx, "ContainerExecCreate")
+	execId, err := cli.ContainerExecCreate(createCtx, containerName, execConfig)
+	endSpan(span, err)
+	if err != nil {
+		return "", 0, err
+	}
+
+	attachCtx, span := tracer.Start(ctx, "ContainerExecAttach", trace.WithAttributes(attribute.String("exec.id", execId.ID)))
+	resp, err := cli.ContainerExecAttach(attachCtx, execId.ID, container.ExecStartOptions{})
+	if err != nil {
+		endSpan(span, err)
+		return "", 0, err
+	}
+	defer resp.Close()
+
+	// The attached connection does not observe the context, close it to
+	// abandon the exec when the context is done
+	stop := context.AfterFunc(ctx, resp.Close)
+	defer stop()
+
+	var outBuf bytes.Buffer
+	_, err = io.Copy(&outBuf, resp.Reader)
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	endSpan(span, err)
+	if err != nil {
+		return "", 0, err
+	}
+
+	inspectCtx, span := tracer.Start(ctx, "ContainerExecInspect", trace.WithAttributes(attribute.String("exec.id", execId.ID)))
+	inspect, err := cli.ContainerExecInspect(inspectCtx, execId.ID)
+	endSpan(span, err)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return outBuf.String(), inspect.ExitCode, nil
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// setupCommandTimeout returns the deadline of the setup command, list
+// commands are expected to be faster than changes.
+func setupCommandTimeout(args []string) time.Duration {
+	if isListCommand(args) {
+		return models.GetListTimeout()
+	}
+	return models.GetChangeTimeout()
+}
+
+// isListCommand reports whether the setup arguments only read the mailserver.
+func isListCommand(args []string) bool {
+	return len(args) > 1 && args[1] == "list"
+}
+
+// setupSubcommand returns the subcommand of the setup arguments without any
+// user data, e.g. "alias add" for "alias add a@b.c d@b.c".
+func setupSubcommand(args []string) string {
+	if len(args) > 2 {
+		args = args[:2]
+	}
+	return strings.Join(args, " ")
+}
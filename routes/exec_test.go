@@ -0,0 +1,148 @@
+package routes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// pipeConn unblocks the reader of the exec output when it is closed, like
+// the connection to the Docker daemon.
+type pipeConn struct {
+	MockHijackedResponseConn
+	writer *io.PipeWriter
+}
+
+func (c *pipeConn) Close() error {
+	return c.writer.Close()
+}
+
+// newHangingExecMock returns a client whose exec never writes any output
+// until the connection is closed.
+func newHangingExecMock() *MockDockerClient {
+	reader, writer := io.Pipe()
+
+	mockClient := new(MockDockerClient)
+	mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{ID: "execId"}, nil)
+	mockClient.On("ContainerExecAttach", mock.Anything, mock.Anything, mock.Anything).Return(types.HijackedResponse{
+		Reader: bufio.NewReader(reader),
+		Conn:   &pipeConn{writer: writer},
+	}, nil)
+	return mockClient
+}
+
+func TestRunSetupCommand(t *testing.T) {
+	t.Run("runSetupCommand should return an error for a non-zero exit code", func(t *testing.T) {
+		mockHijackedResponseConn := new(MockHijackedResponseConn)
+		mockHijackedResponseConn.On("Close").Return(nil)
+
+		mockClient := new(MockDockerClient)
+		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{ID: "execId"}, nil)
+		mockClient.On("ContainerExecAttach", mock.Anything, mock.Anything, mock.Anything).Return(types.HijackedResponse{
+			Reader: bufio.NewReader(bytes.NewBufferString("ERROR: Alias already exists\n")),
+			Conn:   mockHijackedResponseConn,
+		}, nil)
+		mockClient.On("ContainerExecInspect", mock.Anything, "execId").Return(container.ExecInspect{ExitCode: 1}, nil)
+
+		_, err := runSetupCommand(context.Background(), mockClient, "containerId", "alias", "add", "info@website.de", "admin@website.de")
+		assert.EqualError(t, err, "setup alias add failed with exit code 1: ERROR: Alias already exists")
+	})
+
+	t.Run("runSetupCommand should handle ContainerExecInspect error", func(t *testing.T) {
+		mockHijackedResponseConn := new(MockHijackedResponseConn)
+		mockHijackedResponseConn.On("Close").Return(nil)
+
+		mockClient := new(MockDockerClient)
+		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{ID: "execId"}, nil)
+		mockClient.On("ContainerExecAttach", mock.Anything, mock.Anything, mock.Anything).Return(types.HijackedResponse{
+			Reader: bufio.NewReader(bytes.NewBufferString("")),
+			Conn:   mockHijackedResponseConn,
+		}, nil)
+		mockClient.On("ContainerExecInspect", mock.Anything, "execId").Return(nil, errors.New("exec inspect error"))
+
+		_, err := runSetupCommand(context.Background(), mockClient, "containerId", "alias", "list")
+		assert.EqualError(t, err, "exec inspect error")
+	})
+
+	t.Run("runSetupCommand should record a span with command and exit code", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		defer provider.Shutdown(context.Background())
+		previous := otel.GetTracerProvider()
+		otel.SetTracerProvider(provider)
+		t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+		mockClient := newAliasListMock("* postmaster@website.de admin@website.de\n")
+		_, err := runSetupCommand(context.Background(), mockClient, "containerId", "alias", "list")
+		assert.NoError(t, err)
+
+		var span sdktrace.ReadOnlySpan
+		for _, s := range recorder.Ended() {
+			if s.Name() == "setup alias list" {
+				span = s
+			}
+		}
+		if assert.NotNil(t, span) {
+			assert.Contains(t, span.Attributes(), attribute.String("mailserver.command", "setup alias list"))
+			assert.Contains(t, span.Attributes(), attribute.String("container.id", "containerId"))
+			assert.Contains(t, span.Attributes(), attribute.Int("process.exit.code", 0))
+			assert.Contains(t, span.Attributes(), attribute.Int("mailserver.output.bytes", 41))
+			assert.NotEqual(t, codes.Error, span.Status().Code)
+		}
+	})
+
+	t.Run("runSetupCommand should abandon the exec after the deadline", func(t *testing.T) {
+		t.Setenv("LIST_TIMEOUT", "20ms")
+
+		_, err := runSetupCommand(context.Background(), newHangingExecMock(), "containerId", "alias", "list")
+		assert.EqualError(t, err, "setup alias list did not finish in time: context deadline exceeded")
+		assert.Equal(t, 504, errorStatus(err))
+	})
+
+	t.Run("runSetupCommand should abandon lists when the request is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+
+		_, err := runSetupCommand(ctx, newHangingExecMock(), "containerId", "alias", "list")
+		assert.True(t, errors.Is(err, context.Canceled))
+		assert.Equal(t, 499, errorStatus(err))
+	})
+
+	t.Run("runSetupCommand should finish changes when the request is cancelled", func(t *testing.T) {
+		t.Setenv("CHANGE_TIMEOUT", "100ms")
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+
+		start := time.Now()
+		_, err := runSetupCommand(ctx, newHangingExecMock(), "containerId", "alias", "add", "info@website.de", "admin@website.de")
+		assert.EqualError(t, err, "setup alias add did not finish in time: context deadline exceeded")
+		assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	})
+
+	t.Run("setupCommandTimeout should depend on the command", func(t *testing.T) {
+		t.Setenv("LIST_TIMEOUT", "1s")
+		t.Setenv("CHANGE_TIMEOUT", "2s")
+
+		assert.Equal(t, time.Second, setupCommandTimeout([]string{"alias", "list"}))
+		assert.Equal(t, 2*time.Second, setupCommandTimeout([]string{"alias", "add", "info@website.de", "admin@website.de"}))
+	})
+
+	t.Run("setupSubcommand should strip user data", func(t *testing.T) {
+		assert.Equal(t, "alias add", setupSubcommand([]string{"alias", "add", "info@website.de", "admin@website.de"}))
+		assert.Equal(t, "email list", setupSubcommand([]string{"email", "list"}))
+	})
+}
@@ -0,0 +1,128 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+)
+
+const (
+	healthStatusOK   = "ok"
+	healthStatusFail = "fail"
+)
+
+// HealthzGetHandler godoc
+//
+//	@Summary	Liveness probe
+//	@Schemes
+//	@Description	Reports that the API process is alive, without checking any dependencies
+//	@Tags			Utility
+//	@Produce		json
+//	@Success		200	{object}	models.HealthResponse
+//	@Router			/healthz [get]
+func HealthzGetHandler(c *gin.Context) {
+	c.JSON(200, models.HealthResponse{Status: healthStatusOK})
+}
+
+// ReadyzGetHandler godoc
+//
+//	@Summary	Readiness probe
+//	@Schemes
+//	@Description	Checks that the Docker daemon is reachable, the Docker Mailserver container is running and healthy and its setup CLI responds in time
+//	@Tags			Utility
+//	@Produce		json
+//	@Success		200	{object}	models.HealthResponse
+//	@Failure		503	{object}	models.HealthResponse
+//	@Router			/readyz [get]
+func (h *Handler) ReadyzGetHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), models.GetReadinessTimeout())
+	defer cancel()
+
+	response := checkReadiness(ctx, h.docker)
+	if response.Status != healthStatusOK {
+		c.JSON(503, response)
+		return
+	}
+	c.JSON(200, response)
+}
+
+// checkReadiness runs the readiness checks in order and skips the remaining
+// checks after the first failure.
+func checkReadiness(ctx context.Context, cli DockerClient) models.HealthResponse {
+	var containerID string
+
+	checks := []struct {
+		name  string
+		check func() error
+	}{
+		{"docker", func() error {
+			_, err := cli.Ping(ctx)
+			return err
+		}},
+		{"mailserver", func() error {
+			container, err := getMailserverContainer(ctx, cli)
+			if err != nil {
+				return err
+			}
+			containerID = container.ID
+			return checkMailserverHealth(ctx, cli, containerID)
+		}},
+		{"setup", func() error {
+			_, err := runSetupCommand(ctx, cli, containerID, "alias", "list")
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("setup did not respond within %s", models.GetReadinessTimeout())
+			}
+			return err
+		}},
+	}
+
+	response := models.HealthResponse{Status: healthStatusOK, Checks: make([]models.HealthCheckResponse, 0, len(checks))}
+	for _, c := range checks {
+		if response.Status != healthStatusOK {
+			response.Checks = append(response.Checks, models.HealthCheckResponse{Name: c.name, Status: "skipped"})
+			continue
+		}
+
+		start := time.Now()
+		err := c.check()
+		result := models.HealthCheckResponse{
+			Name:       c.name,
+			Status:     healthStatusOK,
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			result.Status = healthStatusFail
+			result.Error = err.Error()
+			response.Status = healthStatusFail
+		}
+		response.Checks = append(response.Checks, result)
+	}
+
+	return response
+}
+
+// checkMailserverHealth fails if the Docker health check of the container
+// does not report it as healthy. Containers without health check pass.
+func checkMailserverHealth(ctx context.Context, cli DockerClient, containerID string) error {
+	health := ""
+	if state, ok, _ := mailserverWatcher.current(); ok && state.ID == containerID {
+		health = state.Health
+	} else {
+		inspect, err := cli.ContainerInspect(ctx, containerID)
+		if err != nil {
+			return err
+		}
+		if inspect.ContainerJSONBase != nil && inspect.State != nil && inspect.State.Health != nil {
+			health = string(inspect.State.Health.Status)
+		}
+	}
+
+	if health != "" && health != "healthy" {
+		return fmt.Errorf("mailserver container is %s", health)
+	}
+	return nil
+}
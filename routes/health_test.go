@@ -0,0 +1,100 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHealth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("GET /healthz should always return ok", func(t *testing.T) {
+		router := gin.New()
+		router.GET("/healthz", HealthzGetHandler)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/healthz", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status": "ok"}`, w.Body.String())
+	})
+
+	t.Run("checkReadiness should pass if all checks pass", func(t *testing.T) {
+		mockClient := newAliasListMock("")
+		mockClient.On("Ping", mock.Anything).Return(types.Ping{}, nil)
+		mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
+			{ID: "containerId", Image: "mailserver/docker-mailserver"},
+		}, nil)
+		mockClient.On("ContainerInspect", mock.Anything, "containerId").Return(container.InspectResponse{
+			ContainerJSONBase: &container.ContainerJSONBase{
+				State: &container.State{Status: "running", Health: &container.Health{Status: "healthy"}},
+			},
+		}, nil)
+
+		response := checkReadiness(context.Background(), mockClient)
+		assert.Equal(t, "ok", response.Status)
+		assert.Len(t, response.Checks, 3)
+		for _, check := range response.Checks {
+			assert.Equal(t, "ok", check.Status, check.Name)
+		}
+	})
+
+	t.Run("checkReadiness should skip the remaining checks after a failure", func(t *testing.T) {
+		mockClient := new(MockDockerClient)
+		mockClient.On("Ping", mock.Anything).Return(nil, errors.New("docker error"))
+
+		response := checkReadiness(context.Background(), mockClient)
+		assert.Equal(t, "fail", response.Status)
+		assert.Equal(t, []models.HealthCheckResponse{
+			{Name: "docker", Status: "fail", Error: "docker error", DurationMs: response.Checks[0].DurationMs},
+			{Name: "mailserver", Status: "skipped"},
+			{Name: "setup", Status: "skipped"},
+		}, response.Checks)
+	})
+
+	t.Run("checkReadiness should fail if the mailserver container is unhealthy", func(t *testing.T) {
+		mockClient := new(MockDockerClient)
+		mockClient.On("Ping", mock.Anything).Return(types.Ping{}, nil)
+		mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
+			{ID: "containerId", Image: "mailserver/docker-mailserver"},
+		}, nil)
+		mockClient.On("ContainerInspect", mock.Anything, "containerId").Return(container.InspectResponse{
+			ContainerJSONBase: &container.ContainerJSONBase{
+				State: &container.State{Status: "running", Health: &container.Health{Status: "unhealthy"}},
+			},
+		}, nil)
+
+		response := checkReadiness(context.Background(), mockClient)
+		assert.Equal(t, "fail", response.Status)
+		assert.Equal(t, "mailserver container is unhealthy", response.Checks[1].Error)
+		mockClient.AssertNotCalled(t, "ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("checkReadiness should fail if setup does not respond in time", func(t *testing.T) {
+		mockClient := new(MockDockerClient)
+		mockClient.On("Ping", mock.Anything).Return(types.Ping{}, nil)
+		mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
+			{ID: "containerId", Image: "mailserver/docker-mailserver"},
+		}, nil)
+		mockClient.On("ContainerInspect", mock.Anything, "containerId").Return(container.InspectResponse{}, nil)
+		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(nil, context.DeadlineExceeded)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 0)
+		defer cancel()
+
+		response := checkReadiness(ctx, mockClient)
+		assert.Equal(t, "fail", response.Status)
+		assert.Contains(t, response.Checks[2].Error, "setup did not respond within")
+	})
+}
@@ -0,0 +1,262 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotencyEntries     = 10000
+	errorCodeIdempotencyReuse = "idempotency_key_reused"
+)
+
+type idempotencyState int
+
+const (
+	idempotencyNew idempotencyState = iota
+	idempotencyReplay
+	idempotencyInProgress
+	idempotencyMismatch
+	idempotencyFull
+)
+
+// idempotentResponse is the response to a request with an Idempotency-Key.
+// Until the request is finished, only the fingerprint is set.
+type idempotentResponse struct {
+	fingerprint string
+	finished    bool
+	status      int
+	header      http.Header
+	body        []byte
+	expires     time.Time
+}
+
+// idempotencyStore keeps the responses to requests with an Idempotency-Key,
+// so that retries of the requests get the same response instead of being
+// executed again. At most maxIdempotencyEntries keys are kept, the responses
+// expiring first make room for new keys.
+type idempotencyStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]*idempotentResponse
+}
+
+var idempotencyKeys = newIdempotencyStore(models.GetIdempotencyTTL())
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*idempotentResponse),
+	}
+}
+
+// IdempotencyMiddleware replays the stored response of POST, PUT and DELETE
+// requests that are retried with the same Idempotency-Key header. Reusing a
+// key for a different request fails with 422, a retry while the first
+// request is still running with 409. Server errors and requests cancelled by
+// the client are not stored, so that the request can be retried.
+func IdempotencyMiddleware(c *gin.Context) {
+	key := c.GetHeader(idempotencyKeyHeader)
+	if key == "" || !isMutation(c.Request.Method) {
+		c.Next()
+		return
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		c.AbortWithStatusJSON(400, models.ErrorResponse{Error: "Invalid Idempotency-Key"})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.AbortWithStatusJSON(400, models.ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Keys are chosen by the clients, so users must not see each other's
+	// responses
+	if a, ok := actorFrom(c.Request.Context()); ok {
+		key = a.user + "\x00" + key
+	}
+
+	response, state := idempotencyKeys.begin(key, requestFingerprint(c.Request, body))
+	switch state {
+	case idempotencyReplay:
+		for name, values := range response.header {
+			c.Writer.Header()[name] = values
+		}
+		c.Header(idempotentReplayedHeader, "true")
+		c.Data(response.status, response.header.Get("Content-Type"), response.body)
+		c.Abort()
+		return
+	case idempotencyInProgress:
+		c.AbortWithStatusJSON(409, models.ErrorResponse{Error: "A request with this Idempotency-Key is still in progress"})
+		return
+	case idempotencyMismatch:
+		c.AbortWithStatusJSON(422, models.ErrorResponse{Error: "Idempotency-Key was already used for a different request", Code: errorCodeIdempotencyReuse})
+		return
+	case idempotencyFull:
+		c.AbortWithStatusJSON(503, models.ErrorResponse{Error: "Too many requests with an Idempotency-Key in progress, try again later"})
+		return
+	}
+
+	writer := &recordingWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+
+	// Deferred to release the key on panics, too
+	completed := false
+	defer func() {
+		// The change might still be applied after the client went away, so
+		// the retry has to check the current state
+		if !completed || c.Request.Context().Err() != nil {
+			idempotencyKeys.forget(key)
+			return
+		}
+		idempotencyKeys.finish(key, writer.Status(), replayedHeader(writer.Header()), writer.body.Bytes())
+	}()
+
+	c.Next()
+	completed = true
+}
+
+// replayedHeaders are the headers of a response that belong to its body. The
+// others, e.g. the request ID or CORS headers, are set by the current chain.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// replayedHeader copies the headers of a response that are replayed.
+func replayedHeader(header http.Header) http.Header {
+	replayed := http.Header{}
+	for _, name := range replayedHeaders {
+		if values := header.Values(name); len(values) > 0 {
+			replayed[name] = slices.Clone(values)
+		}
+	}
+	return replayed
+}
+
+func isMutation(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodDelete
+}
+
+// requestFingerprint identifies a request by its method, URL and body.
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.RequestURI()+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// begin registers a request with the key. For a key that is already known it
+// returns the stored response and whether it can be replayed.
+func (s *idempotencyStore) begin(key string, fingerprint string) (*idempotentResponse, idempotencyState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for k, entry := range s.entries {
+		if entry.finished && now.After(entry.expires) {
+			delete(s.entries, k)
+		}
+	}
+
+	entry, ok := s.entries[key]
+	switch {
+	case !ok:
+		if len(s.entries) >= maxIdempotencyEntries && !s.evict() {
+			return nil, idempotencyFull
+		}
+		s.entries[key] = &idempotentResponse{fingerprint: fingerprint}
+		return nil, idempotencyNew
+	case entry.fingerprint != fingerprint:
+		return nil, idempotencyMismatch
+	case !entry.finished:
+		return nil, idempotencyInProgress
+	default:
+		return entry, idempotencyReplay
+	}
+}
+
+// setTTL changes how long responses finished from now on are kept.
+func (s *idempotencyStore) setTTL(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ttl = ttl
+}
+
+// evict removes the finished response expiring first and reports whether
+// there was one.
+func (s *idempotencyStore) evict() bool {
+	oldest := ""
+	for k, entry := range s.entries {
+		if entry.finished && (oldest == "" || entry.expires.Before(s.entries[oldest].expires)) {
+			oldest = k
+		}
+	}
+	if oldest == "" {
+		return false
+	}
+	delete(s.entries, oldest)
+	return true
+}
+
+// finish stores the response to the request with the key. Server errors and
+// cancelled requests are forgotten, so that the request can be retried.
+func (s *idempotencyStore) finish(key string, status int, header http.Header, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if status >= 500 || status == statusClientClosedRequest {
+		delete(s.entries, key)
+		return
+	}
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	entry.finished = true
+	entry.status = status
+	entry.header = header
+	entry.body = body
+	entry.expires = s.now().Add(s.ttl)
+}
+
+// forget removes the key of a request without a response to replay.
+func (s *idempotencyStore) forget(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+}
+
+// recordingWriter keeps a copy of the response body.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
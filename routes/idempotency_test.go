@@ -0,0 +1,253 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func newIdempotencyRouter(t *testing.T, status int) (*gin.Engine, *int) {
+	original := idempotencyKeys
+	idempotencyKeys = newIdempotencyStore(time.Hour)
+	t.Cleanup(func() { idempotencyKeys = original })
+
+	calls := 0
+	router := gin.New()
+	router.Use(IdempotencyMiddleware)
+	router.POST("/v1/aliases", func(c *gin.Context) {
+		calls++
+		c.Header("Location", "/v1/aliases/test@website.de")
+		c.JSON(status, models.AliasResponse{Alias: "test@website.de", Email: "admin@website.de"})
+	})
+	return router, &calls
+}
+
+func postWithIdempotencyKey(router *gin.Engine, key string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/v1/aliases", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	body := `{"alias": "test@website.de", "email": "admin@website.de"}`
+
+	t.Run("retries with the same key should replay the response", func(t *testing.T) {
+		router, calls := newIdempotencyRouter(t, 201)
+
+		first := postWithIdempotencyKey(router, "key-1", body)
+		second := postWithIdempotencyKey(router, "key-1", body)
+
+		assert.Equal(t, 1, *calls)
+		assert.Equal(t, 201, second.Code)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, "/v1/aliases/test@website.de", second.Header().Get("Location"))
+		assert.Equal(t, "true", second.Header().Get(idempotentReplayedHeader))
+		assert.Empty(t, first.Header().Get(idempotentReplayedHeader))
+	})
+
+	t.Run("retries should not replay the headers of the current chain", func(t *testing.T) {
+		original := idempotencyKeys
+		idempotencyKeys = newIdempotencyStore(time.Hour)
+		t.Cleanup(func() { idempotencyKeys = original })
+
+		requests := 0
+		router := gin.New()
+		router.Use(IdempotencyMiddleware)
+		router.POST("/v1/aliases", func(c *gin.Context) {
+			requests++
+			// Headers of the chain of the first request, not of the response
+			c.Header(requestIDHeader, "request-"+strconv.Itoa(requests))
+			c.Header("Access-Control-Allow-Origin", "https://first.example")
+			c.Header("Vary", "Origin")
+			c.JSON(201, models.AliasResponse{Alias: "test@website.de", Email: "admin@website.de"})
+		})
+
+		postWithIdempotencyKey(router, "key-1", body)
+		second := postWithIdempotencyKey(router, "key-1", body)
+
+		assert.Equal(t, 1, requests)
+		assert.Equal(t, "true", second.Header().Get(idempotentReplayedHeader))
+		assert.Equal(t, "application/json; charset=utf-8", second.Header().Get("Content-Type"))
+		assert.Empty(t, second.Header().Get(requestIDHeader))
+		assert.Empty(t, second.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, second.Header().Get("Vary"))
+	})
+
+	t.Run("requests without key should not be replayed", func(t *testing.T) {
+		router, calls := newIdempotencyRouter(t, 201)
+
+		postWithIdempotencyKey(router, "", body)
+		postWithIdempotencyKey(router, "", body)
+
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("reusing a key for a different request should return 422", func(t *testing.T) {
+		router, calls := newIdempotencyRouter(t, 201)
+
+		postWithIdempotencyKey(router, "key-1", body)
+		w := postWithIdempotencyKey(router, "key-1", `{"alias": "other@website.de", "email": "admin@website.de"}`)
+
+		assert.Equal(t, 1, *calls)
+		assert.Equal(t, 422, w.Code)
+		assert.JSONEq(t, `{"error": "Idempotency-Key was already used for a different request", "code": "idempotency_key_reused"}`, w.Body.String())
+	})
+
+	t.Run("server errors should not be stored", func(t *testing.T) {
+		router, calls := newIdempotencyRouter(t, 503)
+
+		postWithIdempotencyKey(router, "key-1", body)
+		postWithIdempotencyKey(router, "key-1", body)
+
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("cancelled requests should not be stored", func(t *testing.T) {
+		router, calls := newIdempotencyRouter(t, statusClientClosedRequest)
+
+		postWithIdempotencyKey(router, "key-1", body)
+		postWithIdempotencyKey(router, "key-1", body)
+		assert.Equal(t, 2, *calls)
+
+		router, calls = newIdempotencyRouter(t, 201)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req := httptest.NewRequest("POST", "/v1/aliases", strings.NewReader(body)).WithContext(ctx)
+		req.Header.Set(idempotencyKeyHeader, "key-1")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		postWithIdempotencyKey(router, "key-1", body)
+		assert.Equal(t, 2, *calls)
+	})
+
+	t.Run("panics should release the key", func(t *testing.T) {
+		original := idempotencyKeys
+		idempotencyKeys = newIdempotencyStore(time.Hour)
+		t.Cleanup(func() { idempotencyKeys = original })
+
+		calls := 0
+		router := gin.New()
+		router.Use(gin.CustomRecovery(func(c *gin.Context, _ any) { c.AbortWithStatus(500) }), IdempotencyMiddleware)
+		router.POST("/v1/aliases", func(c *gin.Context) {
+			calls++
+			if calls == 1 {
+				panic("handler failed")
+			}
+			c.Status(201)
+		})
+
+		assert.Equal(t, 500, postWithIdempotencyKey(router, "key-1", body).Code)
+		assert.Equal(t, 201, postWithIdempotencyKey(router, "key-1", body).Code)
+	})
+
+	t.Run("begin should make room for new keys by dropping the responses expiring first", func(t *testing.T) {
+		now := time.Now()
+		store := newIdempotencyStore(time.Minute)
+		store.now = func() time.Time { return now }
+		for i := range maxIdempotencyEntries {
+			store.begin(strconv.Itoa(i), "fingerprint")
+		}
+
+		_, state := store.begin("key-1", "fingerprint")
+		assert.Equal(t, idempotencyFull, state)
+
+		store.finish("1", 204, http.Header{}, nil)
+		now = now.Add(time.Second)
+		store.finish("0", 204, http.Header{}, nil)
+		_, state = store.begin("key-1", "fingerprint")
+		assert.Equal(t, idempotencyNew, state)
+		assert.NotContains(t, store.entries, "1")
+		assert.Contains(t, store.entries, "0")
+	})
+
+	t.Run("too long keys should return 400", func(t *testing.T) {
+		router, calls := newIdempotencyRouter(t, 201)
+
+		w := postWithIdempotencyKey(router, strings.Repeat("k", 256), body)
+
+		assert.Equal(t, 0, *calls)
+		assert.Equal(t, 400, w.Code)
+	})
+
+	t.Run("begin should report requests in progress and forget expired responses", func(t *testing.T) {
+		now := time.Now()
+		store := newIdempotencyStore(time.Minute)
+		store.now = func() time.Time { return now }
+
+		_, state := store.begin("key-1", "fingerprint")
+		assert.Equal(t, idempotencyNew, state)
+		_, state = store.begin("key-1", "fingerprint")
+		assert.Equal(t, idempotencyInProgress, state)
+
+		store.finish("key-1", 204, http.Header{}, nil)
+		response, state := store.begin("key-1", "fingerprint")
+		assert.Equal(t, idempotencyReplay, state)
+		assert.Equal(t, 204, response.status)
+
+		now = now.Add(2 * time.Minute)
+		_, state = store.begin("key-1", "fingerprint")
+		assert.Equal(t, idempotencyNew, state)
+	})
+
+	t.Run("the request body should still be readable by the handler", func(t *testing.T) {
+		original := idempotencyKeys
+		idempotencyKeys = newIdempotencyStore(time.Hour)
+		t.Cleanup(func() { idempotencyKeys = original })
+
+		router := gin.New()
+		router.Use(IdempotencyMiddleware)
+		router.POST("/v1/aliases", func(c *gin.Context) {
+			var alias models.AliasResponse
+			assert.NoError(t, c.ShouldBindJSON(&alias))
+			c.JSON(201, alias)
+		})
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/v1/aliases", bytes.NewBufferString(body))
+		req.Header.Set(idempotencyKeyHeader, "key-1")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, 201, w.Code)
+		assert.JSONEq(t, body, w.Body.String())
+	})
+
+	t.Run("keys should not be shared between users", func(t *testing.T) {
+		original := idempotencyKeys
+		idempotencyKeys = newIdempotencyStore(time.Hour)
+		t.Cleanup(func() { idempotencyKeys = original })
+		t.Setenv("FORWARD_AUTH_PROXIES", "192.0.2.1")
+
+		calls := 0
+		router := gin.New()
+		router.Use(ForwardAuthMiddleware, IdempotencyMiddleware)
+		router.POST("/v1/aliases", func(c *gin.Context) {
+			calls++
+			c.Status(201)
+		})
+
+		for _, user := range []string{"john", "jane", "john"} {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/v1/aliases", strings.NewReader(body))
+			req.Header.Set(idempotencyKeyHeader, "key-1")
+			req.Header.Set("Remote-User", user)
+			router.ServeHTTP(w, req)
+			assert.Equal(t, 201, w.Code)
+		}
+
+		assert.Equal(t, 2, calls)
+	})
+}
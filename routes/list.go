@@ -0,0 +1,190 @@
+package routes
+
+import (
+	"cmp"
+	"errors"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+)
+
+const maxListLimit = 1000
+
+// listOptions are the query parameters to search, filter, sort and paginate
+// the alias and email lists.
+type listOptions struct {
+	Query  string
+	Domain string
+	Email  string
+	Sort   string
+	Desc   bool
+	Limit  int
+	Offset int
+}
+
+// parseListOptions reads the list query parameters of the request. The first
+// of the sort fields is the default.
+func parseListOptions(c *gin.Context, sortFields ...string) (listOptions, error) {
+	options := listOptions{
+		Query:  strings.ToLower(strings.TrimSpace(c.Query("q"))),
+		Domain: strings.ToLower(strings.TrimSpace(c.Query("domain"))),
+		Email:  strings.ToLower(strings.TrimSpace(c.Query("email"))),
+		Sort:   c.DefaultQuery("sort", sortFields[0]),
+	}
+
+	if _, err := path.Match(options.Query, ""); err != nil {
+		return listOptions{}, errors.New("Invalid search pattern")
+	}
+
+	if !slices.Contains(sortFields, options.Sort) {
+		return listOptions{}, errors.New("Invalid sort field, expected one of " + strings.Join(sortFields, ", "))
+	}
+
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		options.Desc = true
+	default:
+		return listOptions{}, errors.New("Invalid order, expected asc or desc")
+	}
+
+	var err error
+	if options.Limit, err = queryInt(c, "limit"); err != nil || options.Limit > maxListLimit {
+		return listOptions{}, errors.New("Invalid limit, expected a number between 0 and " + strconv.Itoa(maxListLimit))
+	}
+	if options.Offset, err = queryInt(c, "offset"); err != nil {
+		return listOptions{}, errors.New("Invalid offset")
+	}
+
+	return options, nil
+}
+
+func queryInt(c *gin.Context, key string) (int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid number")
+	}
+	return n, nil
+}
+
+// matchesQuery reports whether one of the values matches the search query. A
+// query with wildcards (*, ? or [...]) is matched as glob against the whole
+// value, any other query as case-insensitive substring.
+func matchesQuery(query string, values ...string) bool {
+	if query == "" {
+		return true
+	}
+
+	glob := strings.ContainsAny(query, "*?[")
+	for _, value := range values {
+		value = strings.ToLower(value)
+		if glob {
+			if ok, _ := path.Match(query, value); ok {
+				return true
+			}
+		} else if strings.Contains(value, query) {
+			return true
+		}
+	}
+	return false
+}
+
+// listAliases applies the list options to the aliases.
+func listAliases(aliases []models.AliasResponse, options listOptions) models.AliasListResponse {
+	result := make([]models.AliasResponse, 0, len(aliases))
+	for _, alias := range aliases {
+		if !matchesQuery(options.Query, alias.Alias, alias.Email) {
+			continue
+		}
+		if options.Domain != "" && domainOf(alias.Alias) != options.Domain {
+			continue
+		}
+		if options.Email != "" && strings.ToLower(alias.Email) != options.Email {
+			continue
+		}
+		result = append(result, alias)
+	}
+
+	slices.SortStableFunc(result, func(a, b models.AliasResponse) int {
+		var order int
+		switch options.Sort {
+		case "email":
+			order = cmp.Or(compareFold(a.Email, b.Email), compareFold(a.Alias, b.Alias))
+		case "domain":
+			order = cmp.Or(cmp.Compare(domainOf(a.Alias), domainOf(b.Alias)), compareFold(a.Alias, b.Alias))
+		default:
+			order = compareFold(a.Alias, b.Alias)
+		}
+		if options.Desc {
+			return -order
+		}
+		return order
+	})
+
+	return models.AliasListResponse{
+		Aliases: paginate(result, options),
+		Total:   len(result),
+		Limit:   options.Limit,
+		Offset:  options.Offset,
+	}
+}
+
+// listEmails applies the list options to the email addresses.
+func listEmails(emails []string, options listOptions) models.EmailListResponse {
+	result := make([]string, 0, len(emails))
+	for _, email := range emails {
+		if !matchesQuery(options.Query, email) {
+			continue
+		}
+		if options.Domain != "" && domainOf(email) != options.Domain {
+			continue
+		}
+		result = append(result, email)
+	}
+
+	slices.SortStableFunc(result, func(a, b string) int {
+		var order int
+		switch options.Sort {
+		case "domain":
+			order = cmp.Or(cmp.Compare(domainOf(a), domainOf(b)), compareFold(a, b))
+		default:
+			order = compareFold(a, b)
+		}
+		if options.Desc {
+			return -order
+		}
+		return order
+	})
+
+	return models.EmailListResponse{
+		Emails: paginate(result, options),
+		Total:  len(result),
+		Limit:  options.Limit,
+		Offset: options.Offset,
+	}
+}
+
+func compareFold(a, b string) int {
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// paginate returns the page of the items selected by offset and limit. A
+// limit of 0 returns all remaining items.
+func paginate[T any](items []T, options listOptions) []T {
+	if options.Offset >= len(items) {
+		return []T{}
+	}
+	items = items[options.Offset:]
+	if options.Limit > 0 && options.Limit < len(items) {
+		items = items[:options.Limit]
+	}
+	return items
+}
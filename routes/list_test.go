@@ -0,0 +1,104 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func newListContext(query string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", "/v1/aliases?"+query, nil)
+	return c
+}
+
+func TestListOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	aliases := []models.AliasResponse{
+		{Alias: "postmaster@website.de", Email: "admin@website.de"},
+		{Alias: "abuse@example.com", Email: "admin@example.com"},
+		{Alias: "info@website.de", Email: "team@website.de"},
+		{Alias: "Sales@example.com", Email: "team@website.de"},
+	}
+
+	t.Run("parseListOptions should use defaults", func(t *testing.T) {
+		options, err := parseListOptions(newListContext(""), "alias", "email", "domain")
+		assert.NoError(t, err)
+		assert.Equal(t, listOptions{Sort: "alias"}, options)
+	})
+
+	t.Run("parseListOptions should read all parameters", func(t *testing.T) {
+		options, err := parseListOptions(newListContext("q=Admin&domain=Website.de&email=team@website.de&sort=domain&order=desc&limit=10&offset=20"), "alias", "email", "domain")
+		assert.NoError(t, err)
+		assert.Equal(t, listOptions{
+			Query:  "admin",
+			Domain: "website.de",
+			Email:  "team@website.de",
+			Sort:   "domain",
+			Desc:   true,
+			Limit:  10,
+			Offset: 20,
+		}, options)
+	})
+
+	t.Run("parseListOptions should reject invalid parameters", func(t *testing.T) {
+		for _, query := range []string{"sort=size", "order=up", "limit=-1", "limit=1001", "limit=ten", "offset=-5", "q=[a"} {
+			_, err := parseListOptions(newListContext(query), "alias", "email", "domain")
+			assert.Error(t, err, query)
+		}
+	})
+
+	t.Run("listAliases should sort by alias and count all aliases", func(t *testing.T) {
+		result := listAliases(aliases, listOptions{Sort: "alias"})
+		assert.Equal(t, 4, result.Total)
+		assert.Equal(t, []models.AliasResponse{aliases[1], aliases[2], aliases[0], aliases[3]}, result.Aliases)
+	})
+
+	t.Run("listAliases should sort by domain in descending order", func(t *testing.T) {
+		result := listAliases(aliases, listOptions{Sort: "domain", Desc: true})
+		assert.Equal(t, []models.AliasResponse{aliases[0], aliases[2], aliases[3], aliases[1]}, result.Aliases)
+	})
+
+	t.Run("listAliases should search alias and destination", func(t *testing.T) {
+		result := listAliases(aliases, listOptions{Query: "team", Sort: "alias"})
+		assert.Equal(t, []models.AliasResponse{aliases[2], aliases[3]}, result.Aliases)
+
+		result = listAliases(aliases, listOptions{Query: "*@example.com", Sort: "alias"})
+		assert.Equal(t, []models.AliasResponse{aliases[1], aliases[3]}, result.Aliases)
+	})
+
+	t.Run("listAliases should filter by domain and destination", func(t *testing.T) {
+		result := listAliases(aliases, listOptions{Domain: "website.de", Email: "team@website.de", Sort: "alias"})
+		assert.Equal(t, 1, result.Total)
+		assert.Equal(t, []models.AliasResponse{aliases[2]}, result.Aliases)
+	})
+
+	t.Run("listAliases should paginate after filtering", func(t *testing.T) {
+		result := listAliases(aliases, listOptions{Sort: "alias", Limit: 2, Offset: 1})
+		assert.Equal(t, models.AliasListResponse{
+			Aliases: []models.AliasResponse{aliases[2], aliases[0]},
+			Total:   4,
+			Limit:   2,
+			Offset:  1,
+		}, result)
+
+		result = listAliases(aliases, listOptions{Sort: "alias", Offset: 10})
+		assert.Equal(t, 4, result.Total)
+		assert.Empty(t, result.Aliases)
+	})
+
+	t.Run("listEmails should search, sort and paginate", func(t *testing.T) {
+		emails := []string{"team@website.de", "admin@example.com", "admin@website.de"}
+
+		result := listEmails(emails, listOptions{Query: "admin", Sort: "domain", Desc: true})
+		assert.Equal(t, models.EmailListResponse{Emails: []string{"admin@website.de", "admin@example.com"}, Total: 2}, result)
+
+		result = listEmails(emails, listOptions{Domain: "website.de", Sort: "email", Limit: 1})
+		assert.Equal(t, models.EmailListResponse{Emails: []string{"admin@website.de"}, Total: 2, Limit: 1}, result)
+	})
+}
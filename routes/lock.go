@@ -0,0 +1,107 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/scheidti/docker-mailserver-aliases/models"
+)
+
+var errLockTimeout = errors.New("Another change to the mailserver is in progress, try again later")
+
+// mutationLock serializes changes to the mailserver, so that the checks made
+// before a change still hold when the change is made. Changes are serialized
+// per container and, if a lock file is configured, across all processes
+// sharing the file.
+type mutationLock struct {
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+	file  string
+}
+
+var mailserverLock = newMutationLock(models.GetLockFile())
+
+func newMutationLock(file string) *mutationLock {
+	return &mutationLock{
+		locks: make(map[string]chan struct{}),
+		file:  file,
+	}
+}
+
+// acquire waits up to the timeout for the lock of the container and returns
+// the function to release it. The cached lists of the container are dropped
+// once the lock is held. errLockTimeout is returned if the lock could not be
+// acquired in time.
+func (l *mutationLock) acquire(ctx context.Context, containerName string, timeout time.Duration) (func(), error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	lock := l.lock(containerName)
+	select {
+	case lock <- struct{}{}:
+	case <-ctx.Done():
+		return nil, lockError(ctx)
+	}
+	release := func() { <-lock }
+
+	l.mu.Lock()
+	file := l.file
+	l.mu.Unlock()
+	if file != "" {
+		unlockFile, err := lockFile(ctx, file)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		unlockContainer := release
+		release = func() {
+			unlockFile()
+			unlockContainer()
+		}
+	}
+
+	// The cached lists might miss changes made before the lock was held,
+	// also by other processes, the checks of the change have to read them
+	// again
+	mailserverCache.invalidate(containerName)
+
+	return release, nil
+}
+
+// setFile changes the lock file used by changes started from now on.
+func (l *mutationLock) setFile(file string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.file = file
+}
+
+func (l *mutationLock) lock(containerName string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lock, ok := l.locks[containerName]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		l.locks[containerName] = lock
+	}
+	return lock
+}
+
+func lockError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return errLockTimeout
+	}
+	return ctx.Err()
+}
+
+// lockErrorStatus returns the HTTP status code for an error returned by
+// acquire.
+func lockErrorStatus(err error) int {
+	if errors.Is(err, errLockTimeout) {
+		return 503
+	}
+	return 500
+}
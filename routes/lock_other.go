@@ -0,0 +1,12 @@
+//go:build !unix
+
+package routes
+
+import (
+	"context"
+	"errors"
+)
+
+func lockFile(ctx context.Context, path string) (func(), error) {
+	return nil, errors.New("LOCK_FILE is only supported on Unix systems")
+}
@@ -0,0 +1,97 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scheidti/docker-mailserver-aliases/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMutationLock(t *testing.T) {
+	t.Run("acquire should serialize changes to the same container", func(t *testing.T) {
+		lock := newMutationLock("")
+
+		unlock, err := lock.acquire(context.Background(), "containerId", time.Second)
+		assert.NoError(t, err)
+
+		_, err = lock.acquire(context.Background(), "containerId", 10*time.Millisecond)
+		assert.True(t, errors.Is(err, errLockTimeout))
+		assert.Equal(t, 503, lockErrorStatus(err))
+
+		unlock()
+		unlock, err = lock.acquire(context.Background(), "containerId", 10*time.Millisecond)
+		assert.NoError(t, err)
+		unlock()
+	})
+
+	t.Run("acquire should drop the cached lists of the container", func(t *testing.T) {
+		t.Cleanup(mailserverCache.invalidateAll)
+		mailserverCache.aliases["containerId"] = cacheEntry[[]models.AliasResponse]{expires: time.Now().Add(time.Hour)}
+		mailserverCache.emails["containerId"] = cacheEntry[[]string]{expires: time.Now().Add(time.Hour)}
+
+		unlock, err := newMutationLock("").acquire(context.Background(), "containerId", time.Second)
+		assert.NoError(t, err)
+		defer unlock()
+
+		assert.NotContains(t, mailserverCache.aliases, "containerId")
+		assert.NotContains(t, mailserverCache.emails, "containerId")
+	})
+
+	t.Run("acquire should not block other containers", func(t *testing.T) {
+		lock := newMutationLock("")
+
+		unlock, err := lock.acquire(context.Background(), "containerId", time.Second)
+		assert.NoError(t, err)
+		defer unlock()
+
+		unlockOther, err := lock.acquire(context.Background(), "otherId", 10*time.Millisecond)
+		assert.NoError(t, err)
+		unlockOther()
+	})
+
+	t.Run("acquire should wait for the lock to be released", func(t *testing.T) {
+		lock := newMutationLock("")
+
+		unlock, err := lock.acquire(context.Background(), "containerId", time.Second)
+		assert.NoError(t, err)
+		time.AfterFunc(20*time.Millisecond, unlock)
+
+		unlock, err = lock.acquire(context.Background(), "containerId", time.Second)
+		assert.NoError(t, err)
+		unlock()
+	})
+
+	t.Run("acquire should serialize processes sharing the lock file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "mailserver-aliases.lock")
+		// Separate locks open the file separately, like other processes would
+		first := newMutationLock(file)
+		second := newMutationLock(file)
+
+		unlock, err := first.acquire(context.Background(), "containerId", time.Second)
+		assert.NoError(t, err)
+
+		_, err = second.acquire(context.Background(), "containerId", 50*time.Millisecond)
+		assert.True(t, errors.Is(err, errLockTimeout))
+
+		unlock()
+		unlock, err = second.acquire(context.Background(), "containerId", time.Second)
+		assert.NoError(t, err)
+		unlock()
+	})
+
+	t.Run("acquire should return other errors of the lock file", func(t *testing.T) {
+		lock := newMutationLock(filepath.Join(t.TempDir(), "missing", "mailserver-aliases.lock"))
+
+		_, err := lock.acquire(context.Background(), "containerId", time.Second)
+		assert.Error(t, err)
+		assert.Equal(t, 500, lockErrorStatus(err))
+
+		// The in-process lock must be released again
+		_, err = lock.acquire(context.Background(), "containerId", 10*time.Millisecond)
+		assert.False(t, errors.Is(err, errLockTimeout))
+	})
+}
@@ -0,0 +1,43 @@
+//go:build unix
+
+package routes
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+const lockFilePollInterval = 25 * time.Millisecond
+
+// lockFile takes an exclusive flock on the file, creating it if needed, and
+// returns the function to unlock it.
+func lockFile(ctx context.Context, path string) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return func() {
+				_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+				file.Close()
+			}, nil
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			file.Close()
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, lockError(ctx)
+		case <-time.After(lockFilePollInterval):
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+const redacted = "[REDACTED]"
+
+// Only accept request IDs that are safe to log and to return in a header
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type requestIDKey struct{}
+
+// NewLogger creates a logger writing either "text" or "json" records.
+func NewLogger(w io.Writer, level slog.Leveler, format string) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level}
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+// RequestIDMiddleware takes the request ID from the X-Request-ID header or
+// generates a new one, returns it in the response and stores it in the
+// request context for logging.
+func RequestIDMiddleware(c *gin.Context) {
+	requestID := c.GetHeader(requestIDHeader)
+	if !validRequestID.MatchString(requestID) {
+		requestID = newRequestID()
+	}
+
+	c.Header(requestIDHeader, requestID)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDKey{}, requestID))
+	c.Next()
+}
+
+// LoggingMiddleware logs every request after it was handled.
+func LoggingMiddleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	status := c.Writer.Status()
+	level := slog.LevelInfo
+	switch {
+	case status >= 500:
+		level = slog.LevelError
+	case status >= 400:
+		level = slog.LevelWarn
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", c.Request.Method),
+		slog.String("path", c.Request.URL.Path),
+		slog.String("route", c.FullPath()),
+		slog.Int("status", status),
+		slog.Duration("duration", time.Since(start)),
+		slog.Int("bytes", c.Writer.Size()),
+		slog.String("client_ip", c.ClientIP()),
+	}
+	if len(c.Errors) > 0 {
+		attrs = append(attrs, slog.String("error", c.Errors.String()))
+	}
+
+	logger(c.Request.Context()).LogAttrs(c.Request.Context(), level, "request handled", attrs...)
+}
+
+// logger returns the default logger with the request ID, the authenticated
+// user and the trace ID of the context attached.
+func logger(ctx context.Context) *slog.Logger {
+	l := slog.Default()
+	if requestID, ok := ctx.Value(requestIDKey{}).(string); ok {
+		l = l.With(slog.String("request_id", requestID))
+	}
+	if a, ok := actorFrom(ctx); ok {
+		l = l.With(slog.String("user", a.user))
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		l = l.With(slog.String("trace_id", spanContext.TraceID().String()))
+	}
+	return l
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// redactSetupArgs hides passwords of setup commands like
+// "email add <address> <password>" before they are logged or traced.
+func redactSetupArgs(args []string) []string {
+	result := append([]string{}, args...)
+	if len(result) > 3 && result[0] == "email" && (result[1] == "add" || result[1] == "update") {
+		for i := 3; i < len(result); i++ {
+			result[i] = redacted
+		}
+	}
+	return result
+}
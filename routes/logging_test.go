@@ -0,0 +1,106 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(NewLogger(&buf, slog.LevelDebug, "json"))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestLogging(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func() *gin.Engine {
+		router := gin.New()
+		router.Use(RequestIDMiddleware, LoggingMiddleware)
+		router.GET("/v1/status", func(c *gin.Context) {
+			logger(c.Request.Context()).Info("handler called")
+			c.Status(200)
+		})
+		return router
+	}
+
+	t.Run("RequestIDMiddleware should return the request ID of the client", func(t *testing.T) {
+		captureLogs(t)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/status", nil)
+		req.Header.Set("X-Request-ID", "abc-123")
+		newRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, "abc-123", w.Header().Get("X-Request-ID"))
+	})
+
+	t.Run("RequestIDMiddleware should replace missing or invalid request IDs", func(t *testing.T) {
+		captureLogs(t)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/status", nil)
+		req.Header.Set("X-Request-ID", "evil\nheader")
+		newRouter().ServeHTTP(w, req)
+
+		assert.Regexp(t, "^[0-9a-f]{32}$", w.Header().Get("X-Request-ID"))
+	})
+
+	t.Run("LoggingMiddleware should log the request with its request ID", func(t *testing.T) {
+		logs := captureLogs(t)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/status", nil)
+		req.Header.Set("X-Request-ID", "abc-123")
+		newRouter().ServeHTTP(w, req)
+
+		lines := bytes.Split(bytes.TrimSpace(logs.Bytes()), []byte("\n"))
+		assert.Len(t, lines, 2)
+
+		var handlerRecord, requestRecord map[string]any
+		assert.NoError(t, json.Unmarshal(lines[0], &handlerRecord))
+		assert.NoError(t, json.Unmarshal(lines[1], &requestRecord))
+
+		assert.Equal(t, "abc-123", handlerRecord["request_id"])
+		assert.Equal(t, "abc-123", requestRecord["request_id"])
+		assert.Equal(t, "request handled", requestRecord["msg"])
+		assert.Equal(t, "/v1/status", requestRecord["route"])
+		assert.Equal(t, float64(200), requestRecord["status"])
+	})
+
+	t.Run("runSetupCommand should log the command with its request ID", func(t *testing.T) {
+		logs := captureLogs(t)
+
+		router := gin.New()
+		router.Use(RequestIDMiddleware)
+		router.POST("/v1/aliases", func(c *gin.Context) {
+			_, _ = runSetupCommand(c.Request.Context(), newAliasListMock(""), "containerId", "alias", "add", "info@website.de", "admin@website.de")
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/aliases", nil)
+		req.Header.Set("X-Request-ID", "abc-123")
+		router.ServeHTTP(w, req)
+
+		assert.Contains(t, logs.String(), `"msg":"setup command finished"`)
+		assert.Contains(t, logs.String(), `"command":"setup alias add info@website.de admin@website.de"`)
+		assert.Contains(t, logs.String(), `"request_id":"abc-123"`)
+	})
+
+	t.Run("redactSetupArgs should hide passwords", func(t *testing.T) {
+		args := []string{"email", "add", "user@website.de", "secret"}
+
+		assert.Equal(t, []string{"email", "add", "user@website.de", redacted}, redactSetupArgs(args))
+		assert.Equal(t, "secret", args[3], "the original arguments should not be modified")
+		assert.Equal(t, []string{"alias", "add", "info@website.de", "admin@website.de"}, redactSetupArgs([]string{"alias", "add", "info@website.de", "admin@website.de"}))
+	})
+}
@@ -0,0 +1,187 @@
+package routes
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+)
+
+const metricsNamespace = "mailserver_aliases"
+
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequestsTotal = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = promauto.With(metricsRegistry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of HTTP requests by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	dockerExecTotal = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "docker_exec_total",
+		Help:      "Number of setup commands run in the mailserver container by subcommand.",
+	}, []string{"command"})
+
+	dockerExecFailures = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "docker_exec_failures_total",
+		Help:      "Number of failed setup commands by subcommand.",
+	}, []string{"command"})
+
+	dockerExecDuration = promauto.With(metricsRegistry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "docker_exec_duration_seconds",
+		Help:      "Duration of setup commands by subcommand.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 4, 8, 16},
+	}, []string{"command"})
+
+	containerDiscoveryFailures = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "container_discovery_failures_total",
+		Help:      "Number of failed lookups of the mailserver container by reason.",
+	}, []string{"reason"})
+
+	aliasesPerDomain = promauto.With(metricsRegistry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "aliases",
+		Help:      "Number of aliases by domain as last read from the mailserver.",
+	}, []string{"domain"})
+
+	mailboxesPerDomain = promauto.With(metricsRegistry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "mailboxes",
+		Help:      "Number of mailboxes by domain as last read from the mailserver.",
+	}, []string{"domain"})
+
+	mailserverUp = promauto.With(metricsRegistry).NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "mailserver_up",
+		Help:      "Whether the mailserver container is running (1) or not (0).",
+	})
+
+	danglingAliases = promauto.With(metricsRegistry).NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "dangling_aliases",
+		Help:      "Number of aliases ending at a missing address of a hosted domain.",
+	})
+
+	rateLimitedRequests = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Number of requests rejected by rate limits by policy.",
+	}, []string{"policy"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// MetricsHandler godoc
+//
+//	@Summary	Prometheus metrics
+//	@Schemes
+//	@Description	Exposes metrics about HTTP requests, Docker execs and the Docker Mailserver container in the Prometheus text format
+//	@Tags			Utility
+//	@Produce		plain
+//	@Success		200
+//	@Router			/metrics [get]
+func MetricsHandler(c *gin.Context) {
+	promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}).ServeHTTP(c.Writer, c.Request)
+}
+
+// MetricsMiddleware records count and duration of every HTTP request.
+func MetricsMiddleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	// Use the route template to keep the number of label values bounded
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+
+	httpRequestsTotal.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+	httpRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+}
+
+func observeExec(command string, duration time.Duration, err error) {
+	dockerExecTotal.WithLabelValues(command).Inc()
+	dockerExecDuration.WithLabelValues(command).Observe(duration.Seconds())
+	if err != nil {
+		dockerExecFailures.WithLabelValues(command).Inc()
+	}
+}
+
+func observeContainerDiscovery(err error) {
+	switch {
+	case err == nil:
+		mailserverUp.Set(1)
+	case errors.Is(err, errMailserverNotFound):
+		containerDiscoveryFailures.WithLabelValues("not_found").Inc()
+		mailserverUp.Set(0)
+	case errors.Is(err, errMailserverNotRunning):
+		containerDiscoveryFailures.WithLabelValues("not_running").Inc()
+		mailserverUp.Set(0)
+	default:
+		// The Docker daemon could not be reached, the container state is unknown
+		containerDiscoveryFailures.WithLabelValues("error").Inc()
+	}
+}
+
+func setMailserverUp(running bool) {
+	if running {
+		mailserverUp.Set(1)
+	} else {
+		mailserverUp.Set(0)
+	}
+}
+
+func observeAliases(aliases []models.AliasResponse) {
+	addresses := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		addresses = append(addresses, alias.Alias)
+	}
+	setCountsPerDomain(aliasesPerDomain, addresses)
+}
+
+func observeMailboxes(emails []string) {
+	setCountsPerDomain(mailboxesPerDomain, emails)
+}
+
+func setCountsPerDomain(gauge *prometheus.GaugeVec, addresses []string) {
+	counts := make(map[string]int)
+	for _, address := range addresses {
+		counts[domainOf(address)]++
+	}
+
+	gauge.Reset()
+	for domain, count := range counts {
+		gauge.WithLabelValues(domain).Set(float64(count))
+	}
+}
+
+func domainOf(address string) string {
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		return strings.ToLower(address[i+1:])
+	}
+	return ""
+}
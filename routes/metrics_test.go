@@ -0,0 +1,79 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("MetricsMiddleware should count requests by route template", func(t *testing.T) {
+		router := gin.New()
+		router.Use(MetricsMiddleware)
+		router.DELETE("/v1/aliases/:alias", func(c *gin.Context) {
+			c.Status(204)
+		})
+
+		before := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("DELETE", "/v1/aliases/:alias", "204"))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/v1/aliases/info@website.de", nil)
+		router.ServeHTTP(w, req)
+
+		after := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("DELETE", "/v1/aliases/:alias", "204"))
+		assert.Equal(t, before+1, after)
+	})
+
+	t.Run("observeExec should count failures by subcommand", func(t *testing.T) {
+		total := testutil.ToFloat64(dockerExecTotal.WithLabelValues("alias add"))
+		failures := testutil.ToFloat64(dockerExecFailures.WithLabelValues("alias add"))
+
+		observeExec(setupSubcommand([]string{"alias", "add", "info@website.de", "admin@website.de"}), time.Second, errors.New("exec error"))
+
+		assert.Equal(t, total+1, testutil.ToFloat64(dockerExecTotal.WithLabelValues("alias add")))
+		assert.Equal(t, failures+1, testutil.ToFloat64(dockerExecFailures.WithLabelValues("alias add")))
+	})
+
+	t.Run("observeAliases should count aliases per domain", func(t *testing.T) {
+		observeAliases([]models.AliasResponse{
+			{Alias: "info@website.de", Email: "admin@website.de"},
+			{Alias: "postmaster@Website.de", Email: "admin@website.de"},
+			{Alias: "info@example.com", Email: "admin@website.de"},
+		})
+
+		assert.Equal(t, 2.0, testutil.ToFloat64(aliasesPerDomain.WithLabelValues("website.de")))
+		assert.Equal(t, 1.0, testutil.ToFloat64(aliasesPerDomain.WithLabelValues("example.com")))
+	})
+
+	t.Run("observeContainerDiscovery should track failures and mailserver state", func(t *testing.T) {
+		before := testutil.ToFloat64(containerDiscoveryFailures.WithLabelValues("not_running"))
+
+		observeContainerDiscovery(nil)
+		assert.Equal(t, 1.0, testutil.ToFloat64(mailserverUp))
+
+		observeContainerDiscovery(errMailserverNotRunning)
+		assert.Equal(t, 0.0, testutil.ToFloat64(mailserverUp))
+		assert.Equal(t, before+1, testutil.ToFloat64(containerDiscoveryFailures.WithLabelValues("not_running")))
+	})
+
+	t.Run("GET /metrics should expose the metrics", func(t *testing.T) {
+		router := gin.New()
+		router.GET("/metrics", MetricsHandler)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/metrics", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "mailserver_aliases_mailserver_up")
+	})
+}
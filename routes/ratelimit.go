@@ -0,0 +1,197 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+	"golang.org/x/time/rate"
+)
+
+const errorCodeRateLimited = "rate_limited"
+
+// rateLimitSweepInterval is how often limiters of clients that were not seen
+// for a while are removed.
+const rateLimitSweepInterval = time.Minute
+
+// rateLimiter keeps a token bucket per key. A bucket holds the count of its
+// rate, so clients can send that many requests at once before they are
+// limited to the rate.
+type rateLimiter struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	buckets map[string]*rateLimitBucket
+	swept   time.Time
+}
+
+type rateLimitBucket struct {
+	limiter *rate.Limiter
+	per     time.Duration
+	seen    time.Time
+}
+
+// rateLimitPolicy is a named rate limit, applied to every client separately.
+type rateLimitPolicy struct {
+	name string
+	rate models.Rate
+}
+
+var apiRateLimiter = newRateLimiter()
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		now:     time.Now,
+		buckets: make(map[string]*rateLimitBucket),
+	}
+}
+
+// allow takes a token from the bucket of the key. If the bucket is empty, it
+// returns false and how long to wait for the next token.
+func (l *rateLimiter) allow(key string, limit models.Rate) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	every := rate.Every(limit.Per / time.Duration(limit.Count))
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &rateLimitBucket{limiter: rate.NewLimiter(every, limit.Count)}
+		l.buckets[key] = bucket
+	} else if bucket.limiter.Limit() != every || bucket.limiter.Burst() != limit.Count {
+		// The rate was reloaded
+		bucket.limiter.SetLimitAt(now, every)
+		bucket.limiter.SetBurstAt(now, limit.Count)
+	}
+	bucket.per = limit.Per
+	bucket.seen = now
+
+	reservation := bucket.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// wait returns how long the bucket of the key needs for the next token,
+// without taking it.
+func (l *rateLimiter) wait(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		return 0
+	}
+
+	now := l.now()
+	reservation := bucket.limiter.ReserveN(now, 1)
+	defer reservation.CancelAt(now)
+	return reservation.DelayFrom(now)
+}
+
+// sweep removes the buckets that were refilled completely since they were
+// last used, as they are the same as new buckets.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < rateLimitSweepInterval {
+		return
+	}
+	l.swept = now
+
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.seen) > bucket.per {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// authFailedKey marks requests whose credentials were rejected in the gin
+// context.
+const authFailedKey = "authFailed"
+
+// rejectCredentials aborts the request with the error and counts it against
+// AUTH_FAILURE_RATE_LIMIT.
+func rejectCredentials(c *gin.Context, status int, response models.ErrorResponse) {
+	c.Set(authFailedKey, true)
+	c.AbortWithStatusJSON(status, response)
+}
+
+// RateLimitMiddleware limits the requests per client IP and per credential
+// of requests with an Authorization header to RATE_LIMIT. Changes are
+// additionally limited to MUTATION_RATE_LIMIT. Client IPs whose credentials
+// were rejected more often than AUTH_FAILURE_RATE_LIMIT are limited before
+// any other check. Limited requests are rejected with 429 and a Retry-After
+// header.
+func RateLimitMiddleware(c *gin.Context) {
+	ip := "ip:" + c.ClientIP()
+	authFailures := models.GetAuthFailureRateLimit()
+	if authFailures.Count > 0 {
+		if wait := apiRateLimiter.wait("auth_failures:" + ip); wait > 0 {
+			rejectRateLimited(c, "auth_failures", wait)
+			return
+		}
+	}
+
+	keys := []string{ip}
+	if authorization := c.GetHeader("Authorization"); authorization != "" {
+		// Only keep a hash of the credential in memory
+		hash := sha256.Sum256([]byte(authorization))
+		keys = append(keys, "credential:"+hex.EncodeToString(hash[:16]))
+	}
+	if !limitRequest(c, keys) {
+		return
+	}
+
+	c.Next()
+
+	// Counted afterwards, as only the authentication knows the result
+	if authFailures.Count > 0 && c.GetBool(authFailedKey) {
+		apiRateLimiter.allow("auth_failures:"+ip, authFailures)
+	}
+}
+
+// UserRateLimitMiddleware limits the requests per authenticated user like
+// RateLimitMiddleware, so that a user of an authenticating proxy cannot
+// spread its requests over many IPs. It runs after the authentication.
+func UserRateLimitMiddleware(c *gin.Context) {
+	if a, ok := actorFrom(c.Request.Context()); ok && !limitRequest(c, []string{"user:" + a.user}) {
+		return
+	}
+	c.Next()
+}
+
+// limitRequest takes a token of every key for RATE_LIMIT and, for changes,
+// MUTATION_RATE_LIMIT. It rejects the request and returns false if a bucket
+// is empty.
+func limitRequest(c *gin.Context, keys []string) bool {
+	policies := []rateLimitPolicy{{"requests", models.GetRateLimit()}}
+	if isMutation(c.Request.Method) {
+		policies = append(policies, rateLimitPolicy{"mutations", models.GetMutationRateLimit()})
+	}
+
+	for _, policy := range policies {
+		if policy.rate.Count == 0 {
+			continue
+		}
+		for _, key := range keys {
+			if ok, wait := apiRateLimiter.allow(policy.name+":"+key, policy.rate); !ok {
+				rejectRateLimited(c, policy.name, wait)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func rejectRateLimited(c *gin.Context, policy string, wait time.Duration) {
+	rateLimitedRequests.WithLabelValues(policy).Inc()
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.AbortWithStatusJSON(429, models.ErrorResponse{Error: "Too many requests, try again later", Code: errorCodeRateLimited})
+}
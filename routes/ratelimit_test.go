@@ -0,0 +1,191 @@
+package routes
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("allow should limit requests to the rate after the burst", func(t *testing.T) {
+		limiter := newRateLimiter()
+		now := time.Now()
+		limiter.now = func() time.Time { return now }
+		limit := models.Rate{Count: 2, Per: time.Minute}
+
+		ok, _ := limiter.allow("client", limit)
+		assert.True(t, ok)
+		ok, _ = limiter.allow("client", limit)
+		assert.True(t, ok)
+		ok, wait := limiter.allow("client", limit)
+		assert.False(t, ok)
+		assert.Equal(t, 30*time.Second, wait)
+
+		ok, _ = limiter.allow("other", limit)
+		assert.True(t, ok, "every key has its own bucket")
+
+		now = now.Add(30 * time.Second)
+		ok, _ = limiter.allow("client", limit)
+		assert.True(t, ok)
+	})
+
+	t.Run("allow should apply reloaded rates", func(t *testing.T) {
+		limiter := newRateLimiter()
+		now := time.Now()
+		limiter.now = func() time.Time { return now }
+
+		ok, _ := limiter.allow("client", models.Rate{Count: 1, Per: time.Hour})
+		assert.True(t, ok)
+		ok, wait := limiter.allow("client", models.Rate{Count: 1, Per: time.Second})
+		assert.False(t, ok)
+		assert.LessOrEqual(t, wait, time.Second)
+	})
+
+	t.Run("sweep should remove refilled buckets", func(t *testing.T) {
+		limiter := newRateLimiter()
+		now := time.Now()
+		limiter.now = func() time.Time { return now }
+
+		limiter.allow("idle", models.Rate{Count: 1, Per: time.Second})
+		limiter.allow("busy", models.Rate{Count: 1, Per: time.Hour})
+
+		now = now.Add(rateLimitSweepInterval)
+		limiter.allow("new", models.Rate{Count: 1, Per: time.Second})
+		assert.NotContains(t, limiter.buckets, "idle")
+		assert.Contains(t, limiter.buckets, "busy")
+	})
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(t *testing.T) *gin.Engine {
+		previous := apiRateLimiter
+		apiRateLimiter = newRateLimiter()
+		t.Cleanup(func() { apiRateLimiter = previous })
+
+		router := gin.New()
+		router.SetTrustedProxies([]string{"10.0.0.1"})
+		router.Use(RateLimitMiddleware)
+		router.GET("/v1/aliases", func(c *gin.Context) { c.Status(200) })
+		router.POST("/v1/aliases", func(c *gin.Context) { c.Status(201) })
+		router.GET("/v1/tokens", func(c *gin.Context) {
+			if c.GetHeader("Authorization") != "Bearer valid" {
+				rejectCredentials(c, 401, models.ErrorResponse{Error: "Invalid API token", Code: errorCodeInvalidAPIToken})
+				return
+			}
+			c.Status(200)
+		})
+		return router
+	}
+
+	requestPath := func(router *gin.Engine, method, path, remoteAddr string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = remoteAddr
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	request := func(router *gin.Engine, method, remoteAddr string, header map[string]string) *httptest.ResponseRecorder {
+		return requestPath(router, method, "/v1/aliases", remoteAddr, header)
+	}
+
+	t.Run("RateLimitMiddleware should reject clients over the limit with 429", func(t *testing.T) {
+		t.Setenv("RATE_LIMIT", "2/m")
+		router := newRouter(t)
+
+		assert.Equal(t, 200, request(router, "GET", "192.0.2.1:1234", nil).Code)
+		assert.Equal(t, 200, request(router, "GET", "192.0.2.1:1234", nil).Code)
+
+		w := request(router, "GET", "192.0.2.1:1234", nil)
+		assert.Equal(t, 429, w.Code)
+		assert.Equal(t, "30", w.Header().Get("Retry-After"))
+		assert.JSONEq(t, `{"error": "Too many requests, try again later", "code": "rate_limited"}`, w.Body.String())
+
+		assert.Equal(t, 200, request(router, "GET", "192.0.2.2:1234", nil).Code, "other clients are not limited")
+	})
+
+	t.Run("RateLimitMiddleware should limit changes separately", func(t *testing.T) {
+		t.Setenv("MUTATION_RATE_LIMIT", "1/h")
+		router := newRouter(t)
+
+		assert.Equal(t, 201, request(router, "POST", "192.0.2.1:1234", nil).Code)
+		assert.Equal(t, 429, request(router, "POST", "192.0.2.1:1234", nil).Code)
+		assert.Equal(t, 200, request(router, "GET", "192.0.2.1:1234", nil).Code)
+	})
+
+	t.Run("RateLimitMiddleware should limit credentials across IPs", func(t *testing.T) {
+		t.Setenv("MUTATION_RATE_LIMIT", "1/h")
+		router := newRouter(t)
+		credential := map[string]string{"Authorization": "Basic YWRtaW46c2VjcmV0"}
+
+		assert.Equal(t, 201, request(router, "POST", "192.0.2.1:1234", credential).Code)
+		assert.Equal(t, 429, request(router, "POST", "192.0.2.2:1234", credential).Code)
+	})
+
+	t.Run("UserRateLimitMiddleware should limit users across IPs", func(t *testing.T) {
+		t.Setenv("MUTATION_RATE_LIMIT", "1/h")
+		previous := apiRateLimiter
+		apiRateLimiter = newRateLimiter()
+		t.Cleanup(func() { apiRateLimiter = previous })
+
+		router := gin.New()
+		router.Use(RateLimitMiddleware, func(c *gin.Context) {
+			user := c.GetHeader("Remote-User")
+			c.Request = c.Request.WithContext(withActor(c.Request.Context(), actor{user: user}))
+		}, UserRateLimitMiddleware)
+		router.POST("/v1/aliases", func(c *gin.Context) { c.Status(201) })
+
+		assert.Equal(t, 201, request(router, "POST", "192.0.2.1:1234", map[string]string{"Remote-User": "alice"}).Code)
+		assert.Equal(t, 429, request(router, "POST", "192.0.2.2:1234", map[string]string{"Remote-User": "alice"}).Code)
+		assert.Equal(t, 201, request(router, "POST", "192.0.2.3:1234", map[string]string{"Remote-User": "bob"}).Code)
+	})
+
+	t.Run("RateLimitMiddleware should only trust X-Forwarded-For of trusted proxies", func(t *testing.T) {
+		t.Setenv("RATE_LIMIT", "1/h")
+		router := newRouter(t)
+
+		assert.Equal(t, 200, request(router, "GET", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "192.0.2.1"}).Code)
+		assert.Equal(t, 200, request(router, "GET", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "192.0.2.2"}).Code)
+
+		assert.Equal(t, 200, request(router, "GET", "192.0.2.9:1234", map[string]string{"X-Forwarded-For": "192.0.2.3"}).Code)
+		assert.Equal(t, 429, request(router, "GET", "192.0.2.9:1234", map[string]string{"X-Forwarded-For": "192.0.2.4"}).Code)
+	})
+
+	t.Run("RateLimitMiddleware should limit clients with rejected credentials", func(t *testing.T) {
+		t.Setenv("AUTH_FAILURE_RATE_LIMIT", "2/h")
+		router := newRouter(t)
+
+		for range 5 {
+			assert.Equal(t, 200, requestPath(router, "GET", "/v1/tokens", "192.0.2.1:1234", map[string]string{"Authorization": "Bearer valid"}).Code)
+		}
+		for i := range 2 {
+			assert.Equal(t, 401, requestPath(router, "GET", "/v1/tokens", "192.0.2.1:1234", map[string]string{"Authorization": "Bearer guess" + strconv.Itoa(i)}).Code)
+		}
+
+		w := requestPath(router, "GET", "/v1/tokens", "192.0.2.1:1234", map[string]string{"Authorization": "Bearer valid"})
+		assert.Equal(t, 429, w.Code)
+		assert.Equal(t, "1800", w.Header().Get("Retry-After"))
+		assert.Equal(t, 200, request(router, "GET", "192.0.2.2:1234", nil).Code, "other clients are not limited")
+	})
+
+	t.Run("RateLimitMiddleware should allow everything when turned off", func(t *testing.T) {
+		t.Setenv("RATE_LIMIT", "off")
+		t.Setenv("MUTATION_RATE_LIMIT", "off")
+		t.Setenv("AUTH_FAILURE_RATE_LIMIT", "off")
+		router := newRouter(t)
+
+		for range 20 {
+			assert.Equal(t, 201, request(router, "POST", "192.0.2.1:1234", nil).Code)
+			assert.Equal(t, 401, requestPath(router, "GET", "/v1/tokens", "192.0.2.1:1234", nil).Code)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package routes
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+)
+
+const errorCodeCrossOriginRequest = "cross_origin_request"
+
+// contentSecurityPolicy only allows the scripts, styles and connections of
+// the embedded frontend, which are all served by the application itself. The
+// daisyUI styles use data: URLs for icons.
+const contentSecurityPolicy = "default-src 'self'; img-src 'self' data:; object-src 'none'; " +
+	"base-uri 'self'; form-action 'self'; frame-ancestors 'none'"
+
+// docsContentSecurityPolicy additionally allows the inline script and styles
+// of the Swagger UI.
+const docsContentSecurityPolicy = "default-src 'self'; script-src 'self' 'unsafe-inline'; " +
+	"style-src 'self' 'unsafe-inline'; img-src 'self' data:; object-src 'none'; " +
+	"base-uri 'self'; form-action 'self'; frame-ancestors 'none'"
+
+const (
+	corsAllowedMethods = "GET, POST, PUT, DELETE"
+	corsAllowedHeaders = "Authorization, Content-Type, If-Match, If-None-Match, " + idempotencyKeyHeader + ", " + requestIDHeader
+	corsExposedHeaders = "ETag, Retry-After, " + idempotentReplayedHeader + ", " + requestIDHeader
+)
+
+// SecurityHeadersMiddleware sets the Content-Security-Policy and the other
+// security headers for the frontend on all responses. The application must
+// not be framed, and responses must not be sniffed as other content types.
+func SecurityHeadersMiddleware(c *gin.Context) {
+	header := c.Writer.Header()
+	header.Set("Content-Security-Policy", contentSecurityPolicy)
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("X-Frame-Options", "DENY")
+	header.Set("Referrer-Policy", "same-origin")
+	header.Set("Cross-Origin-Opener-Policy", "same-origin")
+	c.Next()
+}
+
+// DocsSecurityHeadersMiddleware relaxes the Content-Security-Policy for the
+// Swagger UI.
+func DocsSecurityHeadersMiddleware(c *gin.Context) {
+	c.Header("Content-Security-Policy", docsContentSecurityPolicy)
+	c.Next()
+}
+
+// CORSMiddleware allows the origins in CORS_ALLOWED_ORIGINS to call the API
+// from the browser, including credentials like cookies of an authenticating
+// reverse proxy. Preflight requests are answered directly.
+func CORSMiddleware(c *gin.Context) {
+	origin := c.GetHeader("Origin")
+	if origin == "" {
+		c.Next()
+		return
+	}
+	c.Writer.Header().Add("Vary", "Origin")
+
+	allowed := corsOriginAllowed(origin)
+	preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+	if preflight && !allowed {
+		c.AbortWithStatusJSON(403, models.ErrorResponse{Error: "Origin not allowed", Code: errorCodeCrossOriginRequest})
+		return
+	}
+	if !allowed {
+		c.Next()
+		return
+	}
+
+	c.Header("Access-Control-Allow-Origin", origin)
+	c.Header("Access-Control-Allow-Credentials", "true")
+	if preflight {
+		c.Header("Access-Control-Allow-Methods", corsAllowedMethods)
+		c.Header("Access-Control-Allow-Headers", corsAllowedHeaders)
+		c.Header("Access-Control-Max-Age", "600")
+		c.AbortWithStatus(204)
+		return
+	}
+	c.Header("Access-Control-Expose-Headers", corsExposedHeaders)
+	c.Next()
+}
+
+// CrossOriginProtectionMiddleware protects changes against cross-site request
+// forgery. Browsers send credentials of an authenticating reverse proxy, like
+// cookies or basic authentication, with requests from any site, so changes
+// are only accepted from the frontend itself or from CORS_ALLOWED_ORIGINS.
+// The origin is taken from the Sec-Fetch-Site header, or from the Origin
+// header for older browsers. Requests without either header are not sent by
+// browsers, e.g. by scripts with curl, and are accepted.
+func CrossOriginProtectionMiddleware(c *gin.Context) {
+	if !isMutation(c.Request.Method) {
+		c.Next()
+		return
+	}
+
+	origin := c.GetHeader("Origin")
+	fetchSite := c.GetHeader("Sec-Fetch-Site")
+	switch {
+	case fetchSite == "same-origin" || fetchSite == "none":
+	case fetchSite == "" && (origin == "" || sameOrigin(origin, c.Request.Host)):
+	case corsOriginAllowed(origin):
+	default:
+		logger(c.Request.Context()).Warn("Rejected cross-origin request",
+			slog.String("origin", origin),
+			slog.String("sec_fetch_site", fetchSite),
+		)
+		c.AbortWithStatusJSON(403, models.ErrorResponse{Error: "Cross-origin request rejected", Code: errorCodeCrossOriginRequest})
+		return
+	}
+
+	c.Next()
+}
+
+func corsOriginAllowed(origin string) bool {
+	return origin != "" && slices.ContainsFunc(models.GetCORSAllowedOrigins(), func(allowed string) bool {
+		return strings.EqualFold(allowed, origin)
+	})
+}
+
+// sameOrigin reports whether the Origin header names the host the request
+// was sent to.
+func sameOrigin(origin, host string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, host)
+}
@@ -0,0 +1,141 @@
+package routes
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSecurityRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(SecurityHeadersMiddleware, CORSMiddleware)
+	api := router.Group("/v1", CrossOriginProtectionMiddleware)
+	api.GET("/aliases", func(c *gin.Context) { c.Status(200) })
+	api.POST("/aliases", func(c *gin.Context) { c.Status(201) })
+	api.DELETE("/aliases/:alias", func(c *gin.Context) { c.Status(204) })
+	router.GET("/docs/*any", DocsSecurityHeadersMiddleware, func(c *gin.Context) { c.Status(200) })
+	return router
+}
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := newSecurityRouter()
+
+	t.Run("SecurityHeadersMiddleware should set the security headers", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/aliases", nil))
+
+		assert.Equal(t, contentSecurityPolicy, w.Header().Get("Content-Security-Policy"))
+		assert.Contains(t, w.Header().Get("Content-Security-Policy"), "frame-ancestors 'none'")
+		assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+		assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+		assert.Equal(t, "same-origin", w.Header().Get("Referrer-Policy"))
+	})
+
+	t.Run("DocsSecurityHeadersMiddleware should allow the inline script of the Swagger UI", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/docs/index.html", nil))
+
+		assert.Equal(t, docsContentSecurityPolicy, w.Header().Get("Content-Security-Policy"))
+		assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	})
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://tools.example.com")
+	router := newSecurityRouter()
+
+	t.Run("CORSMiddleware should answer preflight requests of allowed origins", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("OPTIONS", "/v1/aliases/info@example.com", nil)
+		req.Header.Set("Origin", "https://tools.example.com")
+		req.Header.Set("Access-Control-Request-Method", "DELETE")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, 204, w.Code)
+		assert.Equal(t, "https://tools.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), "DELETE")
+		assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "If-Match")
+		assert.Equal(t, "Origin", w.Header().Get("Vary"))
+	})
+
+	t.Run("CORSMiddleware should reject preflight requests of other origins", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("OPTIONS", "/v1/aliases", nil)
+		req.Header.Set("Origin", "https://evil.example.org")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, 403, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+		assert.JSONEq(t, `{"error": "Origin not allowed", "code": "cross_origin_request"}`, w.Body.String())
+	})
+
+	t.Run("CORSMiddleware should expose headers to allowed origins only", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/v1/aliases", nil)
+		req.Header.Set("Origin", "https://TOOLS.example.com")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, "https://TOOLS.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Contains(t, w.Header().Get("Access-Control-Expose-Headers"), "ETag")
+
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/v1/aliases", nil)
+		req.Header.Set("Origin", "https://evil.example.org")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, 200, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	})
+}
+
+func TestCrossOriginProtectionMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://tools.example.com")
+	router := newSecurityRouter()
+
+	tests := []struct {
+		name      string
+		method    string
+		fetchSite string
+		origin    string
+		expected  int
+	}{
+		{"same-origin fetch", "POST", "same-origin", "https://aliases.example.com", 201},
+		{"request typed by the user", "POST", "none", "", 201},
+		{"cross-site fetch", "POST", "cross-site", "https://evil.example.org", 403},
+		{"same-site fetch", "DELETE", "same-site", "https://other.example.com", 403},
+		{"fetch of an allowed origin", "POST", "cross-site", "https://tools.example.com", 201},
+		{"old browser on the same origin", "POST", "", "https://aliases.example.com", 201},
+		{"old browser on another origin", "POST", "", "https://evil.example.org", 403},
+		{"client without browser headers", "DELETE", "", "", 204},
+		{"cross-site read", "GET", "cross-site", "https://evil.example.org", 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := "/v1/aliases"
+			if tt.method == "DELETE" {
+				target += "/info@example.com"
+			}
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, target, nil)
+			req.Host = "aliases.example.com"
+			if tt.fetchSite != "" {
+				req.Header.Set("Sec-Fetch-Site", tt.fetchSite)
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, w.Code)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package routes
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+)
+
+// BodyLimitMiddleware rejects request bodies larger than MAX_BODY_SIZE with
+// 413. The body is read completely before the handler runs.
+func BodyLimitMiddleware(c *gin.Context) {
+	if c.Request.Body == nil || c.Request.Body == http.NoBody {
+		c.Next()
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, models.GetMaxBodySize()))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		c.AbortWithStatusJSON(413, models.ErrorResponse{Error: "Request body too large"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(400, models.ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Next()
+}
+
+// RecoveryMiddleware logs panics of handlers with their stack trace and
+// responds with a JSON error instead of gin's empty response.
+func RecoveryMiddleware(c *gin.Context) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		if recovered == http.ErrAbortHandler {
+			panic(recovered)
+		}
+
+		logger(c.Request.Context()).Error("panic while handling request",
+			slog.Any("panic", recovered),
+			slog.String("stack", string(debug.Stack())),
+		)
+
+		if c.Writer.Written() {
+			c.Abort()
+			return
+		}
+		c.AbortWithStatusJSON(500, models.ErrorResponse{Error: "Internal server error"})
+	}()
+
+	c.Next()
+}
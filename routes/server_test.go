@@ -0,0 +1,69 @@
+package routes
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("MAX_BODY_SIZE", "16")
+
+	router := gin.New()
+	router.Use(BodyLimitMiddleware)
+	router.POST("/v1/aliases", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(201, string(body))
+	})
+
+	t.Run("BodyLimitMiddleware should pass small bodies to the handler", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/aliases", strings.NewReader(`{"alias": "a"}`)))
+
+		assert.Equal(t, 201, w.Code)
+		assert.Equal(t, `{"alias": "a"}`, w.Body.String())
+	})
+
+	t.Run("BodyLimitMiddleware should reject large bodies with 413", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/v1/aliases", strings.NewReader(`{"alias": "info@example.com"}`))
+		req.ContentLength = -1
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, 413, w.Code)
+		assert.JSONEq(t, `{"error": "Request body too large"}`, w.Body.String())
+	})
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(RecoveryMiddleware)
+	router.GET("/panic", func(c *gin.Context) {
+		panic("something went wrong")
+	})
+	router.GET("/abort", func(c *gin.Context) {
+		panic(http.ErrAbortHandler)
+	})
+
+	t.Run("RecoveryMiddleware should respond with a JSON error", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+
+		assert.Equal(t, 500, w.Code)
+		assert.JSONEq(t, `{"error": "Internal server error"}`, w.Body.String())
+	})
+
+	t.Run("RecoveryMiddleware should let http.ErrAbortHandler abort the response", func(t *testing.T) {
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/abort", nil))
+		})
+	})
+}
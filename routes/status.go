@@ -3,74 +3,195 @@ package routes
 import (
 	"context"
 	"errors"
+	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
+	"github.com/docker/docker/api/types/events"
 	"github.com/gin-gonic/gin"
 	"github.com/scheidti/docker-mailserver-aliases/models"
 )
 
 type DockerClient interface {
+	Ping(ctx context.Context) (types.Ping, error)
 	ContainerList(ctx context.Context, options container.ListOptions) ([]types.Container, error)
+	ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error)
 	ContainerExecCreate(ctx context.Context, container string, config container.ExecOptions) (types.IDResponse, error)
 	ContainerExecAttach(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error)
-	Close() error
+	ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error)
+	Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error)
+	NegotiateAPIVersion(ctx context.Context)
 }
 
 // StatusGetHandler godoc
 //
 //	@Summary	Checks Mailserver Docker container
 //	@Schemes
-//	@Description	Checks if the Docker Mailserver Docker container is running
+//	@Description	Checks if the Docker Mailserver Docker container is running and reports details about the container and the number of mailboxes and aliases
 //	@Tags			Utility
 //	@Accept			json
 //	@Produce		json
 //	@Success		200	{object}	models.StatusResponse
 //	@Failure		500	{object}	models.ErrorResponse
+//	@Failure		504	{object}	models.ErrorResponse
+//	@Failure		429	{object}	models.ErrorResponse
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
 //	@Router			/v1/status [get]
-func StatusGetHandler(c *gin.Context) {
-	cli, err := getDockerClient()
-	if err != nil {
-		c.JSON(500, models.ErrorResponse{Error: err.Error()})
-		return
+func (h *Handler) StatusGetHandler(c *gin.Context) {
+	checkIfContainerIsRunning(c, h.docker)
+}
+
+func checkIfContainerIsRunning(c *gin.Context, cli DockerClient) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), models.GetDockerTimeout())
+	defer cancel()
+
+	var containerID string
+	status := models.StatusResponse{Running: true}
+	if state, ok, err := mailserverWatcher.current(); ok {
+		if err != nil || !state.running() {
+			c.JSON(200, models.StatusResponse{Running: false, Health: state.Health})
+			return
+		}
+		containerID = state.ID
+		status.Health = state.Health
+	} else {
+		containers, err := cli.ContainerList(ctx, container.ListOptions{})
+		if err != nil {
+			c.JSON(errorStatus(err), models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		found := false
+		for _, container := range containers {
+			if strings.Contains(container.Image, models.GetDockerImage()) {
+				containerID = container.ID
+				found = true
+				break
+			}
+		}
+
+		setMailserverUp(found)
+		if !found {
+			c.JSON(200, models.StatusResponse{Running: false})
+			return
+		}
 	}
-	defer cli.Close()
 
-	checkIfContainerIsRunning(c, cli)
+	addStatusDetails(c.Request.Context(), cli, containerID, &status)
+	c.JSON(200, status)
 }
 
-func getDockerClient() (DockerClient, error) {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+// addStatusDetails adds information about the running container and the
+// accounts it manages. Details that cannot be read are left out.
+func addStatusDetails(ctx context.Context, cli DockerClient, containerID string, status *models.StatusResponse) {
+	inspectCtx, cancel := context.WithTimeout(ctx, models.GetDockerTimeout())
+	defer cancel()
+
+	inspect, err := cli.ContainerInspect(inspectCtx, containerID)
 	if err != nil {
-		return nil, err
+		logger(ctx).Warn("failed to inspect mailserver container", slog.String("error", err.Error()))
+	} else if inspect.ContainerJSONBase != nil {
+		status.ID = inspect.ID
+		status.Name = strings.TrimPrefix(inspect.Name, "/")
+		status.RestartCount = inspect.RestartCount
+
+		if inspect.State != nil {
+			if inspect.State.Health != nil {
+				status.Health = string(inspect.State.Health.Status)
+			}
+			if startedAt, err := time.Parse(time.RFC3339Nano, inspect.State.StartedAt); err == nil {
+				status.StartedAt = startedAt.UTC().Format(time.RFC3339)
+				status.UptimeSeconds = int64(time.Since(startedAt).Seconds())
+			}
+		}
+
+		if inspect.Config != nil {
+			status.Image, status.Tag = splitImageTag(inspect.Config.Image)
+			status.Version = mailserverVersion(inspect.Config, status.Tag)
+			status.AccountProvisioner = envValue(inspect.Config.Env, "ACCOUNT_PROVISIONER")
+			if status.AccountProvisioner == "" {
+				status.AccountProvisioner = "FILE"
+			}
+		}
 	}
 
-	return cli, nil
+	// API tokens limited to domains only count the accounts of these domains
+	aliases, aliasesErr := mailserverCache.getAliases(ctx, cli, containerID, false)
+	if aliasesErr == nil {
+		count := len(filterAllowedDomains(ctx, aliases.Aliases, aliasAddress))
+		status.Aliases = &count
+	}
+	emails, emailsErr := mailserverCache.getEmails(ctx, cli, containerID, false)
+	if emailsErr == nil {
+		count := len(filterAllowedDomains(ctx, emails, emailAddress))
+		status.Mailboxes = &count
+	}
+	if a, _ := actorFrom(ctx); !a.limitedToDomains() {
+		status.DanglingAliases = danglingAliasCount.Load()
+	} else if aliasesErr == nil && emailsErr == nil {
+		count := len(filterAllowedDomains(ctx, findDanglingAliases(aliases.Aliases, emails), danglingAddress))
+		status.DanglingAliases = &count
+	}
 }
 
-func checkIfContainerIsRunning(c *gin.Context, cli DockerClient) {
-	ctx := context.Background()
+// splitImageTag splits an image reference like
+// "ghcr.io/docker-mailserver/docker-mailserver:14.0" into name and tag.
+func splitImageTag(image string) (string, string) {
+	image, _, _ = strings.Cut(image, "@")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, "latest"
+}
 
-	containers, err := cli.ContainerList(ctx, container.ListOptions{})
-	if err != nil {
-		c.JSON(500, models.ErrorResponse{Error: err.Error()})
-		return
+// mailserverVersion reads the docker-mailserver release from the image
+// environment or labels and falls back to the image tag.
+func mailserverVersion(config *container.Config, tag string) string {
+	if version := envValue(config.Env, "DMS_RELEASE"); version != "" {
+		return version
+	}
+	if version := config.Labels["org.opencontainers.image.version"]; version != "" {
+		return version
 	}
+	return tag
+}
 
-	for _, container := range containers {
-		if strings.Contains(container.Image, models.GetDockerImage()) {
-			c.JSON(200, models.StatusResponse{Running: true})
-			return
+func envValue(env []string, name string) string {
+	for _, e := range env {
+		if value, ok := strings.CutPrefix(e, name+"="); ok {
+			return value
 		}
 	}
+	return ""
+}
 
-	c.JSON(200, models.StatusResponse{Running: false})
+func getMailserverContainer(ctx context.Context, cli DockerClient) (types.Container, error) {
+	ctx, cancel := context.WithTimeout(ctx, models.GetDockerTimeout())
+	defer cancel()
+
+	container, err := findMailserverContainer(ctx, cli)
+	observeContainerDiscovery(err)
+	return container, err
 }
 
-func getMailserverContainer(cli DockerClient) (types.Container, error) {
-	ctx := context.Background()
+func findMailserverContainer(ctx context.Context, cli DockerClient) (types.Container, error) {
+	if state, ok, err := mailserverWatcher.current(); ok {
+		if err != nil {
+			return types.Container{}, err
+		}
+		if !state.running() {
+			return types.Container{}, errMailserverNotRunning
+		}
+		return types.Container{
+			ID:    state.ID,
+			Names: []string{"/" + state.Name},
+			Image: state.Image,
+			State: container.ContainerState(state.State),
+		}, nil
+	}
 
 	containers, err := cli.ContainerList(ctx, container.ListOptions{})
 	if err != nil {
@@ -83,5 +204,32 @@ func getMailserverContainer(cli DockerClient) (types.Container, error) {
 		}
 	}
 
-	return types.Container{}, errors.New("mailserver container not found")
+	return types.Container{}, errMailserverNotFound
+}
+
+// containerErrorStatus returns the HTTP status code for an error returned by
+// getMailserverContainer.
+func containerErrorStatus(err error) int {
+	if errors.Is(err, errMailserverNotFound) || errors.Is(err, errMailserverNotRunning) {
+		return 503
+	}
+	return errorStatus(err)
+}
+
+// statusClientClosedRequest is the nginx status for requests the client
+// closed before the response was sent.
+const statusClientClosedRequest = 499
+
+// errorStatus returns the HTTP status code for an error of a Docker call or
+// setup command: 504 if it did not finish in time, 499 if the client closed
+// the request and 500 otherwise.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return 504
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest
+	default:
+		return 500
+	}
 }
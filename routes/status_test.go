@@ -1,15 +1,21 @@
 package routes
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
 	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -18,6 +24,14 @@ type MockDockerClient struct {
 	mock.Mock
 }
 
+func (m *MockDockerClient) Ping(ctx context.Context) (types.Ping, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return types.Ping{}, args.Error(1)
+	}
+	return args.Get(0).(types.Ping), args.Error(1)
+}
+
 func (m *MockDockerClient) ContainerList(ctx context.Context, options container.ListOptions) ([]types.Container, error) {
 	args := m.Called(ctx, options)
 	if args.Get(0) == nil {
@@ -26,6 +40,14 @@ func (m *MockDockerClient) ContainerList(ctx context.Context, options container.
 	return args.Get(0).([]types.Container), args.Error(1)
 }
 
+func (m *MockDockerClient) ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	args := m.Called(ctx, containerID)
+	if args.Get(0) == nil {
+		return container.InspectResponse{}, args.Error(1)
+	}
+	return args.Get(0).(container.InspectResponse), args.Error(1)
+}
+
 func (m *MockDockerClient) ContainerExecCreate(ctx context.Context, container string, config container.ExecOptions) (types.IDResponse, error) {
 	args := m.Called(ctx, container, config)
 	if args.Get(0) == nil {
@@ -42,8 +64,21 @@ func (m *MockDockerClient) ContainerExecAttach(ctx context.Context, execID strin
 	return args.Get(0).(types.HijackedResponse), args.Error(1)
 }
 
-func (m *MockDockerClient) Close() error {
-	return nil
+func (m *MockDockerClient) ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error) {
+	args := m.Called(ctx, execID)
+	if args.Get(0) == nil {
+		return container.ExecInspect{}, args.Error(1)
+	}
+	return args.Get(0).(container.ExecInspect), args.Error(1)
+}
+
+func (m *MockDockerClient) Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error) {
+	args := m.Called(ctx, options)
+	return args.Get(0).(chan events.Message), args.Get(1).(chan error)
+}
+
+func (m *MockDockerClient) NegotiateAPIVersion(ctx context.Context) {
+	m.Called(ctx)
 }
 
 func TestStatusGetHandler(t *testing.T) {
@@ -54,9 +89,7 @@ func TestStatusGetHandler(t *testing.T) {
 		mockClient.On("ContainerList", mock.Anything, mock.Anything).Return(nil, errors.New("docker error"))
 
 		router := gin.Default()
-		router.GET("/v1/status", func(c *gin.Context) {
-			checkIfContainerIsRunning(c, mockClient)
-		})
+		router.GET("/v1/status", NewHandler(mockClient).StatusGetHandler)
 
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/v1/status", nil)
@@ -73,9 +106,7 @@ func TestStatusGetHandler(t *testing.T) {
 		}, nil)
 
 		router := gin.Default()
-		router.GET("/v1/status", func(c *gin.Context) {
-			checkIfContainerIsRunning(c, mockClient)
-		})
+		router.GET("/v1/status", NewHandler(mockClient).StatusGetHandler)
 
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/v1/status", nil)
@@ -90,11 +121,11 @@ func TestStatusGetHandler(t *testing.T) {
 		mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
 			{Image: "mailserver/docker-mailserver"},
 		}, nil)
+		mockClient.On("ContainerInspect", mock.Anything, mock.Anything).Return(nil, errors.New("inspect error"))
+		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("exec error"))
 
 		router := gin.Default()
-		router.GET("/v1/status", func(c *gin.Context) {
-			checkIfContainerIsRunning(c, mockClient)
-		})
+		router.GET("/v1/status", NewHandler(mockClient).StatusGetHandler)
 
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/v1/status", nil)
@@ -109,11 +140,11 @@ func TestStatusGetHandler(t *testing.T) {
 		mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
 			{Image: "ghcr.io/docker-mailserver/docker-mailserver"},
 		}, nil)
+		mockClient.On("ContainerInspect", mock.Anything, mock.Anything).Return(nil, errors.New("inspect error"))
+		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("exec error"))
 
 		router := gin.Default()
-		router.GET("/v1/status", func(c *gin.Context) {
-			checkIfContainerIsRunning(c, mockClient)
-		})
+		router.GET("/v1/status", NewHandler(mockClient).StatusGetHandler)
 
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/v1/status", nil)
@@ -123,13 +154,135 @@ func TestStatusGetHandler(t *testing.T) {
 		assert.JSONEq(t, `{"running": true}`, w.Body.String())
 	})
 
+	t.Run("Running Docker container should report details", func(t *testing.T) {
+		mailserverCache.invalidateAll()
+		t.Cleanup(mailserverCache.invalidateAll)
+
+		mockHijackedResponseConn := new(MockHijackedResponseConn)
+		mockHijackedResponseConn.On("Close").Return(nil)
+
+		startedAt := time.Now().Add(-time.Hour).UTC()
+		mockClient := new(MockDockerClient)
+		mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
+			{ID: "containerId", Image: "ghcr.io/docker-mailserver/docker-mailserver:14.0"},
+		}, nil)
+		mockClient.On("ContainerInspect", mock.Anything, "containerId").Return(container.InspectResponse{
+			ContainerJSONBase: &container.ContainerJSONBase{
+				ID:           "containerId",
+				Name:         "/mailserver",
+				RestartCount: 2,
+				State: &container.State{
+					Status:    "running",
+					StartedAt: startedAt.Format(time.RFC3339Nano),
+					Health:    &container.Health{Status: "healthy"},
+				},
+			},
+			Config: &container.Config{
+				Image: "ghcr.io/docker-mailserver/docker-mailserver:14.0",
+				Env:   []string{"DMS_RELEASE=v14.0.0", "ACCOUNT_PROVISIONER=FILE"},
+			},
+		}, nil)
+		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{ID: "execId"}, nil)
+		mockClient.On("ContainerExecAttach", mock.Anything, mock.Anything, mock.Anything).Return(types.HijackedResponse{
+			Reader: bufio.NewReader(bytes.NewBufferString("* postmaster@website.de admin@website.de\n* info@website.de admin@website.de")),
+			Conn:   mockHijackedResponseConn,
+		}, nil).Once()
+		mockClient.On("ContainerExecAttach", mock.Anything, mock.Anything, mock.Anything).Return(types.HijackedResponse{
+			Reader: bufio.NewReader(bytes.NewBufferString("* admin@website.de ( 969K / ~ ) [0%]")),
+			Conn:   mockHijackedResponseConn,
+		}, nil).Once()
+		mockClient.On("ContainerExecInspect", mock.Anything, mock.Anything).Return(container.ExecInspect{ExitCode: 0}, nil)
+
+		router := gin.Default()
+		router.GET("/v1/status", NewHandler(mockClient).StatusGetHandler)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/status", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.StatusResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.InDelta(t, 3600, response.UptimeSeconds, 5)
+		response.UptimeSeconds = 0
+		aliases, mailboxes := 2, 1
+		assert.Equal(t, models.StatusResponse{
+			Running:            true,
+			Health:             "healthy",
+			Name:               "mailserver",
+			ID:                 "containerId",
+			Image:              "ghcr.io/docker-mailserver/docker-mailserver",
+			Tag:                "14.0",
+			StartedAt:          startedAt.Format(time.RFC3339),
+			RestartCount:       2,
+			Version:            "v14.0.0",
+			AccountProvisioner: "FILE",
+			Mailboxes:          &mailboxes,
+			Aliases:            &aliases,
+		}, response)
+	})
+
+	t.Run("Running Docker container should only count the domains of the API token", func(t *testing.T) {
+		mailserverCache.invalidateAll()
+		t.Cleanup(mailserverCache.invalidateAll)
+		t.Cleanup(func() { danglingAliasCount.Store(nil) })
+		setDanglingAliasCount(5)
+
+		mockHijackedResponseConn := new(MockHijackedResponseConn)
+		mockHijackedResponseConn.On("Close").Return(nil)
+
+		mockClient := new(MockDockerClient)
+		mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
+			{ID: "containerId", Image: "ghcr.io/docker-mailserver/docker-mailserver:14.0"},
+		}, nil)
+		mockClient.On("ContainerInspect", mock.Anything, "containerId").Return(container.InspectResponse{}, nil)
+		mockClient.On("ContainerExecCreate", mock.Anything, mock.Anything, mock.Anything).Return(types.IDResponse{ID: "execId"}, nil)
+		mockClient.On("ContainerExecAttach", mock.Anything, mock.Anything, mock.Anything).Return(types.HijackedResponse{
+			Reader: bufio.NewReader(bytes.NewBufferString("* postmaster@website.de admin@website.de\n* old@website.de removed@website.de\n* old@other.de removed@other.de")),
+			Conn:   mockHijackedResponseConn,
+		}, nil).Once()
+		mockClient.On("ContainerExecAttach", mock.Anything, mock.Anything, mock.Anything).Return(types.HijackedResponse{
+			Reader: bufio.NewReader(bytes.NewBufferString("* admin@website.de ( 969K / ~ ) [0%]\n* admin@other.de ( 969K / ~ ) [0%]")),
+			Conn:   mockHijackedResponseConn,
+		}, nil).Once()
+		mockClient.On("ContainerExecInspect", mock.Anything, mock.Anything).Return(container.ExecInspect{ExitCode: 0}, nil)
+
+		router := gin.New()
+		router.GET("/v1/status", func(c *gin.Context) {
+			a := actor{user: "token:ci", token: "ci", scopes: []string{ScopeRead}, domains: []string{"website.de"}}
+			c.Request = c.Request.WithContext(withActor(c.Request.Context(), a))
+		}, NewHandler(mockClient).StatusGetHandler)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/status", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response models.StatusResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		aliases, mailboxes, dangling := 2, 1, 1
+		assert.Equal(t, &aliases, response.Aliases)
+		assert.Equal(t, &mailboxes, response.Mailboxes)
+		assert.Equal(t, &dangling, response.DanglingAliases)
+	})
+
+	t.Run("splitImageTag should default to latest", func(t *testing.T) {
+		image, tag := splitImageTag("localhost:5000/mailserver/docker-mailserver")
+		assert.Equal(t, "localhost:5000/mailserver/docker-mailserver", image)
+		assert.Equal(t, "latest", tag)
+
+		image, tag = splitImageTag("mailserver/docker-mailserver:edge@sha256:abc")
+		assert.Equal(t, "mailserver/docker-mailserver", image)
+		assert.Equal(t, "edge", tag)
+	})
+
 	t.Run("getMailserverContainer should return Mailserver container", func(t *testing.T) {
 		mockClient := new(MockDockerClient)
 		mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
 			{Image: "mailserver/docker-mailserver"},
 		}, nil)
 
-		container, err := getMailserverContainer(mockClient)
+		container, err := getMailserverContainer(context.Background(), mockClient)
 		assert.Equal(t, "mailserver/docker-mailserver", container.Image)
 		assert.Nil(t, err)
 	})
@@ -140,7 +293,7 @@ func TestStatusGetHandler(t *testing.T) {
 			{Image: "test/some-other-image"},
 		}, nil)
 
-		container, err := getMailserverContainer(mockClient)
+		container, err := getMailserverContainer(context.Background(), mockClient)
 		assert.Equal(t, types.Container{}, container)
 		assert.NotNil(t, err)
 	})
@@ -149,7 +302,7 @@ func TestStatusGetHandler(t *testing.T) {
 		mockClient := new(MockDockerClient)
 		mockClient.On("ContainerList", mock.Anything, mock.Anything).Return(nil, errors.New("docker error"))
 
-		container, err := getMailserverContainer(mockClient)
+		container, err := getMailserverContainer(context.Background(), mockClient)
 		assert.Equal(t, types.Container{}, container)
 		assert.NotNil(t, err)
 	})
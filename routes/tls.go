@@ -0,0 +1,143 @@
+package routes
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// certCheckInterval limits how often the certificate files are checked for
+// changes during TLS handshakes.
+const certCheckInterval = time.Second
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// NewTLSConfig returns the TLS configuration serving the certificate and key
+// files with at least the given TLS version. The files are loaded again when
+// they change on disk, e.g. after the certificates of the Docker Mailserver
+// were renewed.
+func NewTLSConfig(certFile, keyFile, minVersion string) (*tls.Config, error) {
+	version, ok := tlsVersions[minVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TLS version %q", minVersion)
+	}
+
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:     version,
+		GetCertificate: certs.getCertificate,
+	}, nil
+}
+
+// certReloader serves a certificate and reloads it when the modification time
+// or size of the certificate or key file changed. Until a changed pair of
+// files can be loaded, e.g. because only one of them was replaced yet, the
+// previous certificate is served.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	now      func() time.Time
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	stamp   string
+	checked time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, now: time.Now}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	r.checked = r.now()
+	return r, nil
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now := r.now(); now.Sub(r.checked) >= certCheckInterval {
+		r.checked = now
+		if err := r.reload(); err != nil {
+			slog.Warn("Failed to reload TLS certificate, serving the previous one", slog.String("error", err.Error()))
+		}
+	}
+	return r.cert, nil
+}
+
+// reload loads the certificate if the files changed since they were loaded.
+func (r *certReloader) reload() error {
+	stamp, err := fileStamp(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	if stamp == r.stamp {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	attrs := []any{slog.String("file", r.certFile)}
+	if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+		attrs = append(attrs, slog.String("subject", leaf.Subject.CommonName), slog.Time("not_after", leaf.NotAfter))
+	}
+	slog.Info("Loaded TLS certificate", attrs...)
+
+	r.cert = &cert
+	r.stamp = stamp
+	return nil
+}
+
+// fileStamp identifies the current version of the files by their
+// modification times and sizes. Symbolic links, as used by Let's Encrypt, are
+// followed.
+func fileStamp(files ...string) (string, error) {
+	var stamp strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&stamp, "%d:%d;", info.ModTime().UnixNano(), info.Size())
+	}
+	return stamp.String(), nil
+}
+
+// RedirectToHTTPS redirects every request to the same URL on the HTTPS
+// address, keeping the method and body of the request.
+func RedirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]")
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
+}
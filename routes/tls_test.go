@@ -0,0 +1,140 @@
+package routes
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCertificate writes a self-signed certificate for the common name and
+// its key to the files.
+func writeCertificate(t *testing.T, certFile, keyFile, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	t.Run("NewTLSConfig should fail without valid certificate", func(t *testing.T) {
+		_, err := NewTLSConfig(certFile, keyFile, "1.2")
+		assert.Error(t, err)
+
+		writeCertificate(t, certFile, keyFile, "old.example.com")
+		_, err = NewTLSConfig(certFile, keyFile, "1.1")
+		assert.EqualError(t, err, `unsupported TLS version "1.1"`)
+	})
+
+	t.Run("NewTLSConfig should set the minimum version", func(t *testing.T) {
+		writeCertificate(t, certFile, keyFile, "old.example.com")
+
+		config, err := NewTLSConfig(certFile, keyFile, "1.3")
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(tls.VersionTLS13), config.MinVersion)
+	})
+
+	t.Run("certReloader should reload changed certificates", func(t *testing.T) {
+		writeCertificate(t, certFile, keyFile, "old.example.com")
+		reloader, err := newCertReloader(certFile, keyFile)
+		assert.NoError(t, err)
+
+		now := time.Now()
+		reloader.now = func() time.Time { return now }
+
+		writeCertificate(t, certFile, keyFile, "new.example.com")
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(certFile, later, later)
+		os.Chtimes(keyFile, later, later)
+
+		cert, _ := reloader.getCertificate(nil)
+		assert.Equal(t, "old.example.com", commonName(t, cert), "files are only checked every certCheckInterval")
+
+		now = now.Add(certCheckInterval)
+		cert, _ = reloader.getCertificate(nil)
+		assert.Equal(t, "new.example.com", commonName(t, cert))
+	})
+
+	t.Run("certReloader should keep the certificate if the files are invalid", func(t *testing.T) {
+		writeCertificate(t, certFile, keyFile, "old.example.com")
+		reloader, err := newCertReloader(certFile, keyFile)
+		assert.NoError(t, err)
+
+		now := time.Now()
+		reloader.now = func() time.Time { return now }
+
+		os.WriteFile(keyFile, []byte("incomplete"), 0o600)
+		now = now.Add(certCheckInterval)
+		cert, err := reloader.getCertificate(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "old.example.com", commonName(t, cert))
+	})
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		httpsAddr string
+		target    string
+		expected  string
+	}{
+		{":443", "http://example.com/v1/aliases?q=info", "https://example.com/v1/aliases?q=info"},
+		{":8443", "http://example.com:8080/", "https://example.com:8443/"},
+		{"", "http://example.com/docs/index.html", "https://example.com/docs/index.html"},
+		{":443", "http://[::1]:80/", "https://[::1]/"},
+		{":8443", "http://[::1]/", "https://[::1]:8443/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			RedirectToHTTPS(tt.httpsAddr).ServeHTTP(w, httptest.NewRequest("POST", tt.target, nil))
+
+			assert.Equal(t, 308, w.Code)
+			assert.Equal(t, tt.expected, w.Header().Get("Location"))
+		})
+	}
+}
@@ -0,0 +1,456 @@
+package routes
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+)
+
+// Scopes of API tokens. Users authenticated by the reverse proxy, and all
+// requests if neither API tokens nor forward authentication are enabled, have
+// every scope.
+const (
+	ScopeRead         = "read"
+	ScopeAliasesWrite = "aliases-write"
+)
+
+const (
+	errorCodeAPITokensDisabled = "api_tokens_disabled"
+	errorCodeInvalidAPIToken   = "invalid_api_token"
+	errorCodeInsufficientScope = "insufficient_scope"
+	errorCodeDomainNotAllowed  = "domain_not_allowed"
+)
+
+// apiTokenPrefix marks API tokens, so that they are recognized in the
+// Authorization header and by secret scanners.
+const apiTokenPrefix = "dma_"
+
+// apiTokenLastUsedInterval limits how often the last use of a token is
+// written to the file.
+const apiTokenLastUsedInterval = time.Minute
+
+// apiToken is a token as stored in the file. Only the SHA-256 hash of the
+// token is kept, the token itself is only shown when it is created.
+type apiToken struct {
+	models.APITokenResponse
+	Hash string `json:"hash"`
+
+	savedLastUsed time.Time
+}
+
+type apiTokenFile struct {
+	Tokens []*apiToken `json:"tokens"`
+}
+
+// apiTokenStore keeps the API tokens in memory and writes them to a JSON
+// file whenever they change.
+type apiTokenStore struct {
+	mu     sync.Mutex
+	file   string
+	now    func() time.Time
+	tokens map[string]*apiToken
+}
+
+var apiTokens = newAPITokenStore()
+
+func newAPITokenStore() *apiTokenStore {
+	return &apiTokenStore{
+		now:    time.Now,
+		tokens: make(map[string]*apiToken),
+	}
+}
+
+// LoadAPITokens reads the API tokens from the file, which is created when the
+// first token is created. Without a file, API tokens are disabled.
+func LoadAPITokens(file string) error {
+	return apiTokens.load(file)
+}
+
+func (s *apiTokenStore) load(file string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.file = file
+	s.tokens = make(map[string]*apiToken)
+	if file == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read API tokens: %w", err)
+	}
+
+	var stored apiTokenFile
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return fmt.Errorf("failed to read API tokens from %s: %w", file, err)
+	}
+	for _, token := range stored.Tokens {
+		if token.LastUsedAt != nil {
+			token.savedLastUsed = *token.LastUsedAt
+		}
+		s.tokens[token.ID] = token
+	}
+	return nil
+}
+
+func (s *apiTokenStore) enabled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file != ""
+}
+
+// save writes all tokens to a temporary file, which then replaces the file,
+// so that the file is never left incomplete.
+func (s *apiTokenStore) save() error {
+	stored := apiTokenFile{Tokens: make([]*apiToken, 0, len(s.tokens))}
+	for _, token := range s.tokens {
+		stored.Tokens = append(stored.Tokens, token)
+	}
+	slices.SortFunc(stored.Tokens, compareAPITokens)
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(s.file), filepath.Base(s.file)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save API tokens: %w", err)
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), s.file)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save API tokens: %w", err)
+	}
+	return nil
+}
+
+func (s *apiTokenStore) list() []models.APITokenResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := make([]*apiToken, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		tokens = append(tokens, token)
+	}
+	slices.SortFunc(tokens, compareAPITokens)
+
+	result := make([]models.APITokenResponse, 0, len(tokens))
+	for _, token := range tokens {
+		result = append(result, token.APITokenResponse)
+	}
+	return result
+}
+
+// create adds a token and returns it together with the secret token string.
+func (s *apiTokenStore) create(request models.APITokenRequest, createdBy string) (models.APITokenCreatedResponse, error) {
+	id := randomHex(8)
+	secret := apiTokenPrefix + id + "_" + randomHex(32)
+
+	token := &apiToken{
+		APITokenResponse: models.APITokenResponse{
+			ID:        id,
+			Name:      request.Name,
+			Scopes:    request.Scopes,
+			Domains:   request.Domains,
+			CreatedAt: s.now().UTC().Truncate(time.Second),
+			CreatedBy: createdBy,
+		},
+		Hash: hashAPIToken(secret),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[id] = token
+	if err := s.save(); err != nil {
+		delete(s.tokens, id)
+		return models.APITokenCreatedResponse{}, err
+	}
+	return models.APITokenCreatedResponse{APITokenResponse: token.APITokenResponse, Token: secret}, nil
+}
+
+// revoke deletes the token. It returns false if the token does not exist.
+func (s *apiTokenStore) revoke(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[id]
+	if !ok {
+		return false, nil
+	}
+
+	delete(s.tokens, id)
+	if err := s.save(); err != nil {
+		s.tokens[id] = token
+		return false, err
+	}
+	return true, nil
+}
+
+// authenticate returns the token for the token string and records its use.
+func (s *apiTokenStore) authenticate(secret string) (models.APITokenResponse, bool) {
+	id, _, ok := strings.Cut(strings.TrimPrefix(secret, apiTokenPrefix), "_")
+	if !ok {
+		return models.APITokenResponse{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[id]
+	if !ok || subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hashAPIToken(secret))) != 1 {
+		return models.APITokenResponse{}, false
+	}
+
+	now := s.now().UTC().Truncate(time.Second)
+	token.LastUsedAt = &now
+	if now.Sub(token.savedLastUsed) >= apiTokenLastUsedInterval {
+		token.savedLastUsed = now
+		if err := s.save(); err != nil {
+			slog.Warn("Failed to save last use of API token", slog.String("token", id), slog.String("error", err.Error()))
+		}
+	}
+	return token.APITokenResponse, true
+}
+
+func compareAPITokens(a, b *apiToken) int {
+	return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+}
+
+func hashAPIToken(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// APITokenMiddleware authenticates requests with an API token sent as
+// "Authorization: Bearer dma_...". Requests with unknown or revoked tokens
+// are rejected with 401. Other requests are left to ForwardAuthMiddleware.
+func APITokenMiddleware(c *gin.Context) {
+	scheme, secret, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || !strings.HasPrefix(secret, apiTokenPrefix) {
+		c.Next()
+		return
+	}
+
+	token, ok := apiTokens.authenticate(secret)
+	if !ok {
+		rejectCredentials(c, 401, models.ErrorResponse{Error: "Invalid API token", Code: errorCodeInvalidAPIToken})
+		return
+	}
+
+	a := actor{user: "token:" + token.ID, token: token.ID, scopes: token.Scopes, domains: token.Domains}
+	c.Request = c.Request.WithContext(withActor(c.Request.Context(), a))
+	c.Next()
+}
+
+// RequireScope rejects requests with API tokens without the scope with 403.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a, _ := actorFrom(c.Request.Context())
+		if !a.hasScope(scope) {
+			c.AbortWithStatusJSON(403, models.ErrorResponse{Error: "API token lacks the scope " + scope, Code: errorCodeInsufficientScope})
+			return
+		}
+		c.Next()
+	}
+}
+
+// APITokenManagementMiddleware guards the management of API tokens. Tokens
+// are managed by users authenticated by the reverse proxy only, so that a
+// leaked token cannot create others.
+func APITokenManagementMiddleware(c *gin.Context) {
+	if !apiTokens.enabled() {
+		c.AbortWithStatusJSON(404, models.ErrorResponse{Error: "API tokens are disabled, set API_TOKEN_FILE to enable them", Code: errorCodeAPITokensDisabled})
+		return
+	}
+	a, ok := actorFrom(c.Request.Context())
+	if !ok {
+		c.AbortWithStatusJSON(401, models.ErrorResponse{Error: "Authentication required", Code: errorCodeUnauthenticated})
+		return
+	}
+	if a.token != "" {
+		c.AbortWithStatusJSON(403, models.ErrorResponse{Error: "API tokens cannot manage API tokens", Code: errorCodeInsufficientScope})
+		return
+	}
+	c.Next()
+}
+
+// checkDomainAllowed responds with 403 if the API token of the request is
+// limited to other domains than the domain of the address.
+func checkDomainAllowed(c *gin.Context, address string) bool {
+	a, _ := actorFrom(c.Request.Context())
+	if !a.allowsDomain(domainOf(address)) {
+		c.JSON(403, models.ErrorResponse{Error: "API token is not allowed to change aliases of " + domainOf(address), Code: errorCodeDomainNotAllowed})
+		return false
+	}
+	return true
+}
+
+// filterAllowedDomains removes the entries whose address is of another
+// domain than the API token of the request is limited to, so that such
+// tokens only read the aliases and mailboxes they may change.
+func filterAllowedDomains[T any](ctx context.Context, entries []T, address func(T) string) []T {
+	a, _ := actorFrom(ctx)
+	if !a.limitedToDomains() {
+		return entries
+	}
+	return slices.DeleteFunc(slices.Clone(entries), func(entry T) bool {
+		return !a.allowsDomain(domainOf(address(entry)))
+	})
+}
+
+func aliasAddress(alias models.AliasResponse) string {
+	return alias.Alias
+}
+
+func emailAddress(email string) string {
+	return email
+}
+
+func danglingAddress(dangling models.DanglingAliasResponse) string {
+	return dangling.Alias
+}
+
+// APITokensGetHandler godoc
+//
+//	@Summary	List of all API tokens
+//	@Schemes
+//	@Description	Gets all API tokens with the time they were last used. The tokens themselves are only returned when they are created.
+//	@Tags			API Tokens
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	models.APITokenListResponse
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Failure		429	{object}	models.ErrorResponse
+//	@Router			/v1/tokens [get]
+func APITokensGetHandler(c *gin.Context) {
+	c.JSON(200, models.APITokenListResponse{Tokens: apiTokens.list()})
+}
+
+// APITokensPostHandler godoc
+//
+//	@Summary	Create an API token
+//	@Schemes
+//	@Description	Creates a long-lived API token for scripts, to be sent as "Authorization: Bearer <token>". The token is only returned in this response and stored hashed. A token limited to domains only reads and changes the aliases and mailboxes of these domains. Tokens are only managed by users authenticated by the reverse proxy.
+//	@Tags			API Tokens
+//	@Accept			json
+//	@Produce		json
+//	@Param			token	body		models.APITokenRequest	true	"Name, scopes and domains of the token"
+//	@Success		201		{object}	models.APITokenCreatedResponse
+//	@Failure		400		{object}	models.ErrorResponse
+//	@Failure		401		{object}	models.ErrorResponse
+//	@Failure		403		{object}	models.ErrorResponse
+//	@Failure		404		{object}	models.ErrorResponse
+//	@Failure		413		{object}	models.ErrorResponse
+//	@Failure		429		{object}	models.ErrorResponse
+//	@Failure		500		{object}	models.ErrorResponse
+//	@Router			/v1/tokens [post]
+func APITokensPostHandler(c *gin.Context) {
+	var request models.APITokenRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(400, models.ErrorResponse{Error: "Invalid request body, expected a name and the scopes read or aliases-write"})
+		return
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		c.JSON(400, models.ErrorResponse{Error: "Name must be provided"})
+		return
+	}
+	slices.Sort(request.Scopes)
+	request.Scopes = slices.Compact(request.Scopes)
+	domains := make([]string, 0, len(request.Domains))
+	for _, domain := range request.Domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if _, err := mail.ParseAddress("postmaster@" + domain); err != nil || strings.Contains(domain, "@") {
+			c.JSON(400, models.ErrorResponse{Error: "Invalid domain " + domain})
+			return
+		}
+		domains = append(domains, domain)
+	}
+	slices.Sort(domains)
+	request.Domains = slices.Compact(domains)
+
+	a, _ := actorFrom(c.Request.Context())
+	created, err := apiTokens.create(request, a.user)
+	if err != nil {
+		c.JSON(500, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	logger(c.Request.Context()).Info("API token created",
+		slog.String("token", created.ID),
+		slog.String("name", created.Name),
+		slog.Any("scopes", created.Scopes),
+	)
+	c.JSON(201, created)
+}
+
+// APITokensDeleteHandler godoc
+//
+//	@Summary	Revoke an API token
+//	@Schemes
+//	@Description	Revokes an API token, requests with it fail immediately
+//	@Tags			API Tokens
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path	string	true	"ID of the token"
+//	@Success		204
+//	@Failure		401	{object}	models.ErrorResponse
+//	@Failure		403	{object}	models.ErrorResponse
+//	@Failure		404	{object}	models.ErrorResponse
+//	@Failure		429	{object}	models.ErrorResponse
+//	@Failure		500	{object}	models.ErrorResponse
+//	@Router			/v1/tokens/{id} [delete]
+func APITokensDeleteHandler(c *gin.Context) {
+	revoked, err := apiTokens.revoke(c.Param("id"))
+	if err != nil {
+		c.JSON(500, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !revoked {
+		c.JSON(404, models.ErrorResponse{Error: "API token not found"})
+		return
+	}
+
+	logger(c.Request.Context()).Info("API token revoked", slog.String("token", c.Param("id")))
+	c.Status(204)
+}
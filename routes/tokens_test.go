@@ -0,0 +1,258 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/scheidti/docker-mailserver-aliases/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestAPITokenStore replaces the API tokens by a store using a file in a
+// temporary directory.
+func newTestAPITokenStore(t *testing.T) string {
+	original := apiTokens
+	apiTokens = newAPITokenStore()
+	t.Cleanup(func() { apiTokens = original })
+
+	file := filepath.Join(t.TempDir(), "tokens.json")
+	if err := apiTokens.load(file); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestAPITokenStore(t *testing.T) {
+	t.Run("tokens should be stored hashed and survive a restart", func(t *testing.T) {
+		file := newTestAPITokenStore(t)
+
+		created, err := apiTokens.create(models.APITokenRequest{Name: "CI", Scopes: []string{ScopeRead}, Domains: []string{}}, "john")
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(created.Token, "dma_"+created.ID+"_"))
+		assert.Equal(t, "john", created.CreatedBy)
+
+		data, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(data), created.Token)
+		assert.Contains(t, string(data), hashAPIToken(created.Token))
+
+		assert.NoError(t, apiTokens.load(file))
+		token, ok := apiTokens.authenticate(created.Token)
+		assert.True(t, ok)
+		assert.Equal(t, "CI", token.Name)
+	})
+
+	t.Run("authenticate should reject unknown and modified tokens", func(t *testing.T) {
+		newTestAPITokenStore(t)
+		created, _ := apiTokens.create(models.APITokenRequest{Name: "CI", Scopes: []string{ScopeRead}}, "")
+
+		for _, secret := range []string{"dma_", "dma_unknown_secret", created.Token + "0", strings.TrimSuffix(created.Token, created.Token[len(created.Token)-1:])} {
+			_, ok := apiTokens.authenticate(secret)
+			assert.False(t, ok, secret)
+		}
+	})
+
+	t.Run("authenticate should save the last use at most every interval", func(t *testing.T) {
+		file := newTestAPITokenStore(t)
+		now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+		apiTokens.now = func() time.Time { return now }
+		created, _ := apiTokens.create(models.APITokenRequest{Name: "CI", Scopes: []string{ScopeRead}}, "")
+
+		savedLastUsed := func() *time.Time {
+			var stored apiTokenFile
+			data, _ := os.ReadFile(file)
+			assert.NoError(t, json.Unmarshal(data, &stored))
+			return stored.Tokens[0].LastUsedAt
+		}
+
+		apiTokens.authenticate(created.Token)
+		assert.Equal(t, now, *savedLastUsed())
+
+		now = now.Add(time.Second)
+		apiTokens.authenticate(created.Token)
+		assert.Equal(t, now, *apiTokens.list()[0].LastUsedAt)
+		assert.Equal(t, now.Add(-time.Second), *savedLastUsed())
+
+		now = now.Add(apiTokenLastUsedInterval)
+		apiTokens.authenticate(created.Token)
+		assert.Equal(t, now, *savedLastUsed())
+	})
+
+	t.Run("revoked tokens should be rejected", func(t *testing.T) {
+		newTestAPITokenStore(t)
+		created, _ := apiTokens.create(models.APITokenRequest{Name: "CI", Scopes: []string{ScopeRead}}, "")
+
+		revoked, err := apiTokens.revoke(created.ID)
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+		_, ok := apiTokens.authenticate(created.Token)
+		assert.False(t, ok)
+
+		revoked, err = apiTokens.revoke(created.ID)
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+	})
+}
+
+func newAPITokenRouter() *gin.Engine {
+	router := gin.New()
+	api := router.Group("/v1", APITokenMiddleware, ForwardAuthMiddleware)
+	api.GET("/aliases", RequireScope(ScopeRead), func(c *gin.Context) { c.Status(200) })
+	api.DELETE("/aliases/:alias", RequireScope(ScopeAliasesWrite), func(c *gin.Context) {
+		if checkDomainAllowed(c, c.Param("alias")) {
+			c.Status(204)
+		}
+	})
+
+	tokens := api.Group("/tokens", APITokenManagementMiddleware)
+	tokens.GET("", APITokensGetHandler)
+	tokens.POST("", APITokensPostHandler)
+	tokens.DELETE("/:id", APITokensDeleteHandler)
+	return router
+}
+
+// sendWithToken sends the request with the API token through the proxy
+// 10.0.0.1, or as the user john authenticated by the proxy without a token.
+func sendWithToken(router *gin.Engine, method, target, token, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.RemoteAddr = "10.0.0.1:1234"
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		req.Header.Set("Remote-User", "john")
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func sendAnonymous(router *gin.Engine, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestAPITokenMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("FORWARD_AUTH_PROXIES", "10.0.0.1")
+	newTestAPITokenStore(t)
+	router := newAPITokenRouter()
+
+	readOnly, _ := apiTokens.create(models.APITokenRequest{Name: "Monitoring", Scopes: []string{ScopeRead}}, "")
+	writer, _ := apiTokens.create(models.APITokenRequest{Name: "CI", Scopes: []string{ScopeRead, ScopeAliasesWrite}, Domains: []string{"example.com"}}, "")
+
+	t.Run("APITokenMiddleware should reject invalid tokens", func(t *testing.T) {
+		w := sendWithToken(router, "GET", "/v1/aliases", "dma_0000_invalid", "")
+
+		assert.Equal(t, 401, w.Code)
+		assert.JSONEq(t, `{"error": "Invalid API token", "code": "invalid_api_token"}`, w.Body.String())
+	})
+
+	t.Run("RequireScope should reject tokens without the scope", func(t *testing.T) {
+		assert.Equal(t, 200, sendWithToken(router, "GET", "/v1/aliases", readOnly.Token, "").Code)
+
+		w := sendWithToken(router, "DELETE", "/v1/aliases/info@example.com", readOnly.Token, "")
+		assert.Equal(t, 403, w.Code)
+		assert.JSONEq(t, `{"error": "API token lacks the scope aliases-write", "code": "insufficient_scope"}`, w.Body.String())
+
+		assert.Equal(t, 204, sendWithToken(router, "DELETE", "/v1/aliases/info@example.com", writer.Token, "").Code)
+	})
+
+	t.Run("checkDomainAllowed should reject changes to other domains", func(t *testing.T) {
+		w := sendWithToken(router, "DELETE", "/v1/aliases/info@website.de", writer.Token, "")
+
+		assert.Equal(t, 403, w.Code)
+		assert.JSONEq(t, `{"error": "API token is not allowed to change aliases of website.de", "code": "domain_not_allowed"}`, w.Body.String())
+		assert.Equal(t, 204, sendWithToken(router, "DELETE", "/v1/aliases/info@website.de", "", "").Code)
+	})
+
+	t.Run("API tokens should be accepted without a user of the proxy", func(t *testing.T) {
+		assert.Equal(t, 401, sendAnonymous(router, "GET", "/v1/aliases").Code)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/v1/aliases", nil)
+		req.Header.Set("Authorization", "Bearer "+readOnly.Token)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, 200, w.Code)
+	})
+
+	t.Run("filterAllowedDomains should hide other domains from limited tokens", func(t *testing.T) {
+		aliases := []models.AliasResponse{{Alias: "info@Example.com", Email: "admin@example.com"}, {Alias: "info@website.de", Email: "admin@website.de"}}
+		limited := withActor(context.Background(), actor{token: writer.ID, domains: writer.Domains})
+
+		assert.Equal(t, aliases[:1], filterAllowedDomains(limited, aliases, aliasAddress))
+		assert.Len(t, aliases, 2, "the entries are not modified")
+		assert.Equal(t, aliases, filterAllowedDomains(withActor(context.Background(), actor{token: readOnly.ID}), aliases, aliasAddress))
+		assert.Equal(t, aliases, filterAllowedDomains(withActor(context.Background(), actor{user: "john"}), aliases, aliasAddress))
+	})
+}
+
+func TestAPITokenHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("FORWARD_AUTH_PROXIES", "10.0.0.1")
+
+	t.Run("API tokens should be disabled without API_TOKEN_FILE", func(t *testing.T) {
+		original := apiTokens
+		apiTokens = newAPITokenStore()
+		t.Cleanup(func() { apiTokens = original })
+
+		w := sendWithToken(newAPITokenRouter(), "GET", "/v1/tokens", "", "")
+		assert.Equal(t, 404, w.Code)
+		assert.Contains(t, w.Body.String(), errorCodeAPITokensDisabled)
+	})
+
+	t.Run("users should create, list and revoke tokens", func(t *testing.T) {
+		newTestAPITokenStore(t)
+		router := newAPITokenRouter()
+
+		w := sendWithToken(router, "POST", "/v1/tokens", "", `{"name": " CI ", "scopes": ["aliases-write", "read", "read"], "domains": ["Example.com"]}`)
+		assert.Equal(t, 201, w.Code)
+		var created models.APITokenCreatedResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		assert.Equal(t, "CI", created.Name)
+		assert.Equal(t, []string{"aliases-write", "read"}, created.Scopes)
+		assert.Equal(t, []string{"example.com"}, created.Domains)
+		assert.NotEmpty(t, created.Token)
+
+		w = sendWithToken(router, "GET", "/v1/tokens", "", "")
+		assert.Equal(t, 200, w.Code)
+		assert.Contains(t, w.Body.String(), created.ID)
+		assert.NotContains(t, w.Body.String(), created.Token)
+		assert.NotContains(t, w.Body.String(), "hash")
+
+		assert.Equal(t, 204, sendWithToken(router, "DELETE", "/v1/tokens/"+created.ID, "", "").Code)
+		assert.Equal(t, 404, sendWithToken(router, "DELETE", "/v1/tokens/"+created.ID, "", "").Code)
+	})
+
+	t.Run("APITokensPostHandler should reject invalid tokens", func(t *testing.T) {
+		newTestAPITokenStore(t)
+		router := newAPITokenRouter()
+
+		for _, body := range []string{
+			`{"scopes": ["read"]}`,
+			`{"name": " ", "scopes": ["read"]}`,
+			`{"name": "CI", "scopes": []}`,
+			`{"name": "CI", "scopes": ["admin"]}`,
+			`{"name": "CI", "scopes": ["read"], "domains": ["info@example.com"]}`,
+		} {
+			assert.Equal(t, 400, sendWithToken(router, "POST", "/v1/tokens", "", body).Code, body)
+		}
+	})
+
+	t.Run("API tokens should not manage API tokens", func(t *testing.T) {
+		newTestAPITokenStore(t)
+		router := newAPITokenRouter()
+		created, _ := apiTokens.create(models.APITokenRequest{Name: "CI", Scopes: []string{ScopeRead, ScopeAliasesWrite}}, "")
+
+		w := sendWithToken(router, "POST", "/v1/tokens", created.Token, `{"name": "Copy", "scopes": ["read"]}`)
+		assert.Equal(t, 403, w.Code)
+		assert.JSONEq(t, `{"error": "API tokens cannot manage API tokens", "code": "insufficient_scope"}`, w.Body.String())
+	})
+}